@@ -0,0 +1,300 @@
+// Package cache keeps generated files in a directory, named by their
+// content, and removes the least recently used ones once there are too many
+// or they haven't been used for too long.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options limit the cache, where zero is no limit
+type Options struct {
+	// MaxBytes is the total size of the files
+	MaxBytes int64
+	// MaxFiles is the number of files
+	MaxFiles int
+	// MaxAge is how long a file is kept after it was last used
+	MaxAge time.Duration
+	// Grace is how long a file is kept after it was last used whatever the
+	// other limits, so that a file that was just returned can still be fetched
+	Grace time.Duration
+}
+
+// Stats are the metrics of the cache
+type Stats struct {
+	Hits      int64   `json:"hits"`
+	Misses    int64   `json:"misses"`
+	Shared    int64   `json:"shared"`
+	Evictions int64   `json:"evictions"`
+	Errors    int64   `json:"errors"`
+	HitRate   float64 `json:"hitRate"`
+	Files     int     `json:"files"`
+	Bytes     int64   `json:"bytes"`
+}
+
+type entry struct {
+	name string
+	size int64
+	used time.Time
+}
+
+// call is a file that is being generated
+type call struct {
+	done chan struct{}
+	err  error
+}
+
+// Cache is a directory of generated files
+type Cache struct {
+	dir     string
+	options Options
+
+	mutex   sync.Mutex
+	loaded  bool
+	lru     *list.List
+	entries map[string]*list.Element
+	bytes   int64
+	calls   map[string]*call
+	stats   Stats
+
+	// now is the time, which tests can change
+	now func() time.Time
+}
+
+// New returns the cache in the directory, which is created (and the files
+// already in it are found) when it is first used
+func New(dir string, options Options) *Cache {
+	return &Cache{
+		dir:     dir,
+		options: options,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+		calls:   make(map[string]*call),
+		now:     time.Now,
+	}
+}
+
+// load finds the files already in the directory, the most recently modified
+// (which is when they were last used) first. It must be called with the lock
+// held.
+func (c *Cache) load() (err error) {
+	if c.loaded {
+		return
+	}
+	if err = os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+	files, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			// left over from a server that stopped while generating
+			os.Remove(path.Join(c.dir, f.Name()))
+			continue
+		}
+		c.entries[f.Name()] = c.lru.PushBack(&entry{name: f.Name(), size: f.Size(), used: f.ModTime()})
+		c.bytes += f.Size()
+	}
+	c.loaded = true
+	c.evict()
+	return
+}
+
+// evict removes the files that are too old, and then the least recently
+// used files until the cache is within its limits. The most recently used
+// file, and the files used within the grace period, are always kept. It must
+// be called with the lock held.
+func (c *Cache) evict() {
+	for e := c.lru.Back(); e != nil && c.lru.Len() > 1; e = c.lru.Back() {
+		ent := e.Value.(*entry)
+		if c.now().Sub(ent.used) < c.options.Grace {
+			return
+		}
+		tooOld := c.options.MaxAge > 0 && c.now().Sub(ent.used) > c.options.MaxAge
+		tooBig := c.options.MaxBytes > 0 && c.bytes > c.options.MaxBytes
+		tooMany := c.options.MaxFiles > 0 && c.lru.Len() > c.options.MaxFiles
+		if !tooOld && !tooBig && !tooMany {
+			return
+		}
+		c.remove(e)
+		c.stats.Evictions++
+	}
+}
+
+// use marks the file as just used, also in its modification time so that it
+// is still known after a restart. It must be called with the lock held.
+func (c *Cache) use(e *list.Element) {
+	ent := e.Value.(*entry)
+	ent.used = c.now()
+	c.lru.MoveToFront(e)
+	os.Chtimes(path.Join(c.dir, ent.name), ent.used, ent.used)
+}
+
+func (c *Cache) remove(e *list.Element) {
+	ent := e.Value.(*entry)
+	os.Remove(path.Join(c.dir, ent.name))
+	c.lru.Remove(e)
+	delete(c.entries, ent.name)
+	c.bytes -= ent.size
+}
+
+// Get returns the path of the file with the name, generating it with create
+// if it isn't in the cache. The file is generated only once, even if it is
+// asked for again while it is being generated.
+func (c *Cache) Get(ctx context.Context, name string, create func(ctx context.Context, w io.Writer) error) (fileName string, err error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".tmp") {
+		err = errors.New("bad name " + name)
+		return
+	}
+	fileName = path.Join(c.dir, name)
+	for {
+		c.mutex.Lock()
+		if err = c.load(); err != nil {
+			c.mutex.Unlock()
+			return
+		}
+		if e, ok := c.entries[name]; ok {
+			if _, errStat := os.Stat(fileName); errStat == nil {
+				c.use(e)
+				c.stats.Hits++
+				c.mutex.Unlock()
+				return
+			}
+			// removed by someone else
+			c.remove(e)
+		}
+		if cl, ok := c.calls[name]; ok {
+			c.stats.Shared++
+			c.mutex.Unlock()
+			select {
+			case <-cl.done:
+			case <-ctx.Done():
+				err = ctx.Err()
+				return
+			}
+			if cl.err == nil {
+				return
+			}
+			if ctx.Err() == nil && (errors.Is(cl.err, context.Canceled) || errors.Is(cl.err, context.DeadlineExceeded)) {
+				// only the request that was generating it was cancelled
+				continue
+			}
+			err = cl.err
+			return
+		}
+		break
+	}
+
+	cl := &call{done: make(chan struct{})}
+	c.calls[name] = cl
+	c.stats.Misses++
+	c.mutex.Unlock()
+
+	size, err := c.generate(ctx, fileName, create)
+
+	c.mutex.Lock()
+	if err == nil {
+		c.entries[name] = c.lru.PushFront(&entry{name: name, size: size})
+		c.bytes += size
+		c.use(c.entries[name])
+		c.evict()
+	} else {
+		c.stats.Errors++
+	}
+	delete(c.calls, name)
+	cl.err = err
+	close(cl.done)
+	c.mutex.Unlock()
+	return
+}
+
+// Open opens the file with the name, if it is in the cache, and marks it as
+// used. The file can still be read if it is evicted before it is closed.
+func (c *Cache) Open(name string) (f *os.File, err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err = c.load(); err != nil {
+		return
+	}
+	e, ok := c.entries[name]
+	if !ok {
+		err = os.ErrNotExist
+		return
+	}
+	if f, err = os.Open(path.Join(c.dir, name)); err != nil {
+		// removed by someone else
+		c.remove(e)
+		return
+	}
+	c.use(e)
+	return
+}
+
+// Evict removes the files that are too old or over the limits, which Get
+// only does when it generates a file
+func (c *Cache) Evict() (err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err = c.load(); err != nil {
+		return
+	}
+	c.evict()
+	return
+}
+
+// generate writes to a temporary file first, so there is never half a file
+func (c *Cache) generate(ctx context.Context, fileName string, create func(ctx context.Context, w io.Writer) error) (size int64, err error) {
+	f, err := ioutil.TempFile(c.dir, path.Base(fileName)+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(f.Name())
+	err = create(ctx, f)
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Chmod(f.Name(), 0644); err != nil {
+		return
+	}
+	info, err := os.Stat(f.Name())
+	if err != nil {
+		return
+	}
+	size = info.Size()
+	err = os.Rename(f.Name(), fileName)
+	return
+}
+
+// Stats returns the metrics of the cache
+func (c *Cache) Stats() (stats Stats) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stats = c.stats
+	if requests := stats.Hits + stats.Misses + stats.Shared; requests > 0 {
+		stats.HitRate = float64(stats.Hits+stats.Shared) / float64(requests)
+	}
+	stats.Files = c.lru.Len()
+	stats.Bytes = c.bytes
+	return
+}
@@ -0,0 +1,220 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func write(s string) func(context.Context, io.Writer) error {
+	return func(ctx context.Context, w io.Writer) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	c := New(path.Join(dir, "graphs"), Options{MaxBytes: 10})
+	ctx := context.Background()
+
+	fileName, err := c.Get(ctx, "a.svg", write("aaaa"))
+	assert.Nil(t, err)
+	assert.Equal(t, path.Join(dir, "graphs", "a.svg"), fileName)
+	b, _ := ioutil.ReadFile(fileName)
+	assert.Equal(t, "aaaa", string(b))
+	info, err := os.Stat(path.Join(dir, "graphs"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	_, err = c.Get(ctx, "a.svg", write("different"))
+	assert.Nil(t, err)
+	b, _ = ioutil.ReadFile(fileName)
+	assert.Equal(t, "aaaa", string(b))
+
+	// b is the least recently used once a is used, so it is evicted
+	_, err = c.Get(ctx, "b.svg", write("bbbb"))
+	assert.Nil(t, err)
+	_, err = c.Get(ctx, "a.svg", write("aaaa"))
+	assert.Nil(t, err)
+	_, err = c.Get(ctx, "c.svg", write("cccc"))
+	assert.Nil(t, err)
+	_, err = os.Stat(path.Join(dir, "graphs", "b.svg"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(dir, "graphs", "a.svg"))
+	assert.Nil(t, err)
+
+	stats := c.Stats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(3), stats.Misses)
+	assert.Equal(t, int64(1), stats.Evictions)
+	assert.Equal(t, 0.4, stats.HitRate)
+	assert.Equal(t, 2, stats.Files)
+	assert.Equal(t, int64(8), stats.Bytes)
+
+	// failures leave nothing behind
+	_, err = c.Get(ctx, "d.svg", func(ctx context.Context, w io.Writer) error {
+		io.WriteString(w, "half")
+		return errors.New("failed")
+	})
+	assert.NotNil(t, err)
+	files, _ := ioutil.ReadDir(path.Join(dir, "graphs"))
+	assert.Equal(t, 2, len(files))
+
+	_, err = c.Get(ctx, "../e.svg", write("e"))
+	assert.NotNil(t, err)
+
+	// the files are found again
+	c = New(path.Join(dir, "graphs"), Options{})
+	_, err = c.Get(ctx, "c.svg", write("different"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), c.Stats().Hits)
+	assert.Equal(t, 2, c.Stats().Files)
+}
+
+func TestCacheAge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	c := New(dir, Options{MaxAge: time.Hour})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err = c.Get(ctx, "a.svg", write("a"))
+	assert.Nil(t, err)
+	now = now.Add(2 * time.Hour)
+	_, err = c.Get(ctx, "b.svg", write("b"))
+	assert.Nil(t, err)
+	_, err = os.Stat(path.Join(dir, "a.svg"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 1, c.Stats().Files)
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	c := New(dir, Options{})
+	var created int32
+	start := make(chan struct{})
+	create := func(ctx context.Context, w io.Writer) error {
+		atomic.AddInt32(&created, 1)
+		<-start
+		_, err := io.WriteString(w, strings.Repeat("a", 100))
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Get(context.Background(), "a.png", create)
+			assert.Nil(t, err)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(start)
+	wg.Wait()
+	assert.Equal(t, int32(1), created)
+	stats := c.Stats()
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.Equal(t, int64(9), stats.Hits+stats.Shared)
+}
+
+func TestCacheUse(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	c := New(dir, Options{})
+	now := time.Now().Add(-time.Hour)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err = c.Get(ctx, "a.svg", write("a"))
+	assert.Nil(t, err)
+	now = now.Add(time.Minute)
+	_, err = c.Get(ctx, "b.svg", write("b"))
+	assert.Nil(t, err)
+
+	// a is used after b, which is remembered after a reload
+	now = now.Add(time.Minute)
+	f, err := c.Open("a.svg")
+	assert.Nil(t, err)
+	b, _ := ioutil.ReadAll(f)
+	f.Close()
+	assert.Equal(t, "a", string(b))
+	c = New(dir, Options{MaxFiles: 1})
+	c.now = func() time.Time { return now }
+	assert.Nil(t, c.Evict())
+	_, err = os.Stat(path.Join(dir, "a.svg"))
+	assert.Nil(t, err)
+	_, err = os.Stat(path.Join(dir, "b.svg"))
+	assert.True(t, os.IsNotExist(err))
+
+	// and so is a hit
+	c = New(dir, Options{})
+	c.now = func() time.Time { return now }
+	now = now.Add(time.Minute)
+	_, err = c.Get(ctx, "b.svg", write("b"))
+	assert.Nil(t, err)
+	now = now.Add(time.Minute)
+	fileName, err := c.Get(ctx, "a.svg", write("different"))
+	assert.Nil(t, err)
+	c = New(dir, Options{MaxFiles: 1})
+	assert.Nil(t, c.Evict())
+	b, _ = ioutil.ReadFile(fileName)
+	assert.Equal(t, "a", string(b))
+	_, err = os.Stat(path.Join(dir, "b.svg"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = c.Open("b.svg")
+	assert.True(t, os.IsNotExist(err))
+	_, err = c.Open("../a.svg")
+	assert.NotNil(t, err)
+}
+
+func TestCacheGrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cache")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	c := New(dir, Options{MaxFiles: 1, MaxAge: time.Hour, Grace: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	// a was just returned, so it is kept over the limit
+	_, err = c.Get(ctx, "a.svg", write("a"))
+	assert.Nil(t, err)
+	_, err = c.Get(ctx, "b.svg", write("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, c.Stats().Files)
+
+	now = now.Add(2 * time.Minute)
+	assert.Nil(t, c.Evict())
+	_, err = os.Stat(path.Join(dir, "a.svg"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 1, c.Stats().Files)
+
+	// the age is checked without anything new being generated
+	_, err = c.Get(ctx, "c.svg", write("c"))
+	assert.Nil(t, err)
+	now = now.Add(2 * time.Hour)
+	assert.Nil(t, c.Evict())
+	_, err = os.Stat(path.Join(dir, "b.svg"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 1, c.Stats().Files)
+}
@@ -0,0 +1,182 @@
+// Package card prints plans as recipe cards, either as a self-contained
+// HTML page or as a PDF.
+package card
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// Card is everything on a recipe card, formatted
+type Card struct {
+	Title    string
+	Quantity string
+	Cost     string
+	Time     string
+	Servings string
+	Start    string
+	Ready    string
+	Buy      []Item
+	Make     []Item
+	Steps    []Step
+	Graph    recipe.Graph
+}
+
+// Item is something to buy or to make, with why, and with where its price
+// is from
+type Item struct {
+	Name    string
+	Amount  string
+	Cost    string
+	Why     string
+	Notes   [][]recipe.NoteLink
+	Scratch string
+}
+
+// Step is a direction, in order
+type Step struct {
+	Name  string
+	Time  string
+	Start string
+	Ready string
+	Why   string
+	Texts []string
+}
+
+// New returns the card of the plan
+func New(plan recipe.Plan) (c Card) {
+	payload := plan.UpdateApp()
+	c = Card{
+		Title:    strings.Title(plan.Recipe),
+		Quantity: recipe.FormatMeasure(payload.Amount, payload.Measure),
+		Cost:     fmt.Sprintf("$%2.2f", float64(plan.CostCents)/100),
+		Time:     payload.TotalTime,
+		Start:    plan.Start,
+		Ready:    plan.Ready,
+		Buy:      []Item{},
+		Make:     []Item{},
+		Steps:    []Step{},
+		Graph:    recipe.PlanGraph(plan),
+	}
+	if payload.Servings > 0 {
+		c.Servings = fmt.Sprintf("%g servings of %s, %s each", payload.Servings, payload.ServingSize, payload.CostPerServing)
+	}
+	for i, ing := range payload.Ingredients {
+		item := Item{
+			Name:   ing.Name,
+			Amount: ing.Amount,
+			Cost:   ing.Cost,
+			Why:    ing.Why,
+			Notes:  recipe.ParseNotes(plan.Ingredients[i].Notes),
+		}
+		if ing.ScratchTime != "" {
+			item.Scratch = fmt.Sprintf("Making it instead takes %s (%s)", strings.ToLower(ing.ScratchTime), ing.ScratchCost)
+		}
+		c.Buy = append(c.Buy, item)
+	}
+
+	// the amount of everything that is made, from the tree
+	amounts := make(map[string]recipe.Quantity)
+	for _, node := range plan.Nodes {
+		if !node.Made {
+			continue
+		}
+		q := amounts[node.Name]
+		q.Unit = node.Quantity.Unit
+		q.Value += node.Quantity.Value
+		amounts[node.Name] = q
+	}
+	for _, direction := range payload.Directions {
+		c.Make = append(c.Make, Item{
+			Name:   direction.Name,
+			Amount: recipe.FormatQuantity(amounts[direction.Name]),
+			Why:    direction.Why,
+		})
+		c.Steps = append(c.Steps, Step{
+			Name:  direction.Name,
+			Time:  direction.TotalTime,
+			Start: direction.Start,
+			Ready: direction.Ready,
+			Why:   direction.Why,
+			Texts: direction.Texts,
+		})
+	}
+	return
+}
+
+var page = template.Must(template.New("card").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} | Recursive Recipes</title>
+<style>
+body { font-family: Georgia, serif; color: #222; max-width: 48em; margin: 2em auto; padding: 0 1em; line-height: 1.4; }
+h1 { margin-bottom: 0; }
+h2 { border-bottom: 1px solid #ccc; margin-top: 1.5em; }
+.summary, .why, .notes { color: #555; }
+.why, .notes { font-size: 0.9em; }
+ul, ol { padding-left: 1.5em; }
+li { margin-bottom: 0.5em; }
+.graph svg { max-width: 100%; height: auto; }
+@media print {
+  body { margin: 0; max-width: none; }
+  a { color: inherit; text-decoration: none; }
+  a[href]::after { content: " (" attr(href) ")"; font-size: 0.8em; word-break: break-all; }
+  .step, li { break-inside: avoid; }
+  .graph { break-before: page; }
+}
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="summary">{{.Quantity}} &middot; {{.Cost}} &middot; {{.Time}}{{if .Servings}}<br>{{.Servings}}{{end}}{{if .Start}}<br>Start {{.Start}}, ready {{.Ready}}{{end}}</p>
+
+<h2>Buy</h2>
+<ul>
+{{- range .Buy}}
+<li><strong>{{.Amount}} {{.Name}}</strong> ({{.Cost}}){{if .Why}}<div class="why">{{.Why}}</div>{{end}}{{if .Scratch}}<div class="why">{{.Scratch}}</div>{{end}}
+{{- range .Notes}}<div class="notes">{{range .}}{{if .URL}}<a href="{{.URL}}">{{.Text}}</a>{{else}}{{.Text}}{{end}}{{end}}</div>{{end}}</li>
+{{- end}}
+</ul>
+{{- if .Make}}
+
+<h2>Make</h2>
+<ul>
+{{- range .Make}}
+<li><strong>{{.Amount}} {{.Name}}</strong>{{if .Why}}<div class="why">{{.Why}}</div>{{end}}</li>
+{{- end}}
+</ul>
+
+<h2>Directions</h2>
+<ol>
+{{- range .Steps}}
+<li class="step"><strong>Make {{.Name}}</strong>{{if .Time}} ({{.Time}}){{end}}{{if .Start}} <span class="why">{{.Start}} to {{.Ready}}</span>{{end}}
+{{- range .Texts}}<p>{{.}}</p>{{end}}</li>
+{{- end}}
+</ol>
+{{- end}}
+
+<h2>Graph</h2>
+<div class="graph">{{.GraphSVG}}</div>
+</body>
+</html>
+`))
+
+// HTML writes the card as a page that has everything in it, including the
+// graph, and that prints with the urls of its links
+func (c Card) HTML(w io.Writer) (err error) {
+	var svg bytes.Buffer
+	if err = recipe.ExportGraph(context.Background(), c.Graph, "svg", recipe.Themes["light"], &svg); err != nil {
+		return
+	}
+	return page.Execute(w, struct {
+		Card
+		GraphSVG template.HTML
+	}{c, template.HTML(svg.String())})
+}
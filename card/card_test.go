@@ -0,0 +1,85 @@
+package card
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCard(t *testing.T) Card {
+	recipe.CatalogFile = "../recipes.toml"
+	plan, err := recipe.GetPlan(recipe.RequestFromApp{
+		Recipe:             "chocolate chip cookies",
+		MinutesToBuild:     600,
+		IngredientsToBuild: map[string]struct{}{"chocolate chip cookies": {}},
+		NoGraph:            true,
+	})
+	assert.Nil(t, err)
+	return New(plan)
+}
+
+func TestHTML(t *testing.T) {
+	c := testCard(t)
+	assert.Equal(t, "Chocolate Chip Cookies", c.Title)
+	assert.True(t, len(c.Buy) > 0)
+	assert.True(t, len(c.Steps) > 0)
+	assert.Equal(t, len(c.Make), len(c.Steps))
+
+	var b bytes.Buffer
+	assert.Nil(t, c.HTML(&b))
+	page := b.String()
+	assert.True(t, strings.HasPrefix(page, "<!DOCTYPE html>"))
+	assert.True(t, strings.Contains(page, "<h1>Chocolate Chip Cookies</h1>"))
+	assert.True(t, strings.Contains(page, `<a href="https://www.walmart.com/ip/Great-Value-Pure-Vanilla-Extract-2-fl-oz/10314950">2 fl oz is $6.92</a>`))
+	assert.True(t, strings.Contains(page, "<svg"))
+	assert.True(t, strings.Contains(page, "Make whole wheat flour"))
+}
+
+func TestPDF(t *testing.T) {
+	c := testCard(t)
+	var b bytes.Buffer
+	assert.Nil(t, c.PDF(&b))
+	pdf := b.Bytes()
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+
+	// every object is where the table says
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	assert.NotNil(t, m)
+	xref, _ := strconv.Atoi(string(m[1]))
+	lines := strings.Split(string(pdf[xref:]), "\n")
+	assert.Equal(t, "xref", lines[0])
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for i := 1; i < count; i++ {
+		offset, _ := strconv.Atoi(lines[2+i][:10])
+		assert.True(t, bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj", i))))
+	}
+
+	// the text is in the pages
+	text := ""
+	for _, stream := range regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindAllSubmatch(pdf, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(stream[1]))
+		assert.Nil(t, err)
+		content, _ := ioutil.ReadAll(r)
+		text += string(content)
+	}
+	assert.True(t, strings.Contains(text, "(Chocolate Chip Cookies) Tj"))
+	assert.True(t, strings.Contains(text, "(1. Make whole wheat flour"))
+	assert.True(t, strings.Contains(text, "(2 fl oz is $6.92 <https://www.walmart.com/ip/Great-Value-Pure-Vanilla-Extract-2-fl-oz/10314950>) Tj"))
+	assert.True(t, strings.Contains(text, "(Graph) Tj"))
+}
+
+func TestEncode(t *testing.T) {
+	assert.Equal(t, "1 \xbd cups", encode("1 ½ cups"))
+	assert.Equal(t, "1 3/8 cups", encode("1 ⅜ cups"))
+	assert.Equal(t, `a \(b\) \\`, escape(`a (b) \`))
+	assert.InDelta(t, 5.56, textWidth("a", regular, 10), 1e-9)
+}
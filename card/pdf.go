@@ -0,0 +1,322 @@
+package card
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// a letter page, in points
+const (
+	pageWidth  = 612.0
+	pageHeight = 792.0
+	margin     = 54.0
+)
+
+// the fonts are the standard Helvetica fonts, which every reader has
+const (
+	regular = "F1"
+	bold    = "F2"
+)
+
+// helveticaWidths are the widths of the printable ASCII characters of
+// Helvetica, in thousandths of the font size
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// winAnsi are the characters outside of ASCII and Latin-1 that the fonts
+// have, or what is written instead
+var winAnsi = map[rune]string{
+	'‘': "\x91", '’': "\x92", '“': "\x93", '”': "\x94", '•': "\x95", '–': "\x96", '—': "\x97", '…': "\x85",
+	'⅛': "1/8", '⅜': "3/8", '⅝': "5/8", '⅞': "7/8", '⅓': "1/3", '⅔': "2/3",
+}
+
+// encode converts the text to the WinAnsi encoding of the fonts
+func encode(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x80:
+			b.WriteRune(r)
+		case winAnsi[r] != "":
+			b.WriteString(winAnsi[r])
+		case r >= 0xA0 && r <= 0xFF:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// textWidth is the width of the encoded text, where bold is a bit wider
+func textWidth(s string, font string, size float64) (width float64) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 32 && c < 127 {
+			width += float64(helveticaWidths[c-32])
+		} else {
+			width += 556
+		}
+	}
+	width *= size / 1000
+	if font == bold {
+		width *= 1.05
+	}
+	return
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`, "\r", "", "\n", " ").Replace(s)
+}
+
+// document is a PDF that is written from the top down, starting new pages
+// as needed
+type document struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	// y is where the next line goes, from the bottom of the page
+	y float64
+}
+
+func (d *document) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pageHeight - margin
+}
+
+// ensure starts a new page if there is less room than the height left
+func (d *document) ensure(height float64) {
+	if d.page == nil || d.y-height < margin {
+		d.newPage()
+	}
+}
+
+func (d *document) space(height float64) {
+	d.y -= height
+}
+
+func (d *document) text(x, y float64, font string, size float64, gray float64, s string) {
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f g %.2f %.2f Td (%s) Tj ET\n", font, size, gray, x, y, escape(s))
+}
+
+// paragraph writes the text wrapped to the width of the page
+func (d *document) paragraph(s string, font string, size float64, indent float64, gray float64) {
+	leading := size * 1.3
+	width := pageWidth - 2*margin - indent
+	words := strings.Fields(encode(s))
+	line := ""
+	flush := func() {
+		d.ensure(leading)
+		d.y -= leading
+		d.text(margin+indent, d.y, font, size, gray, line)
+		line = ""
+	}
+	for _, word := range words {
+		if line != "" && textWidth(line+" "+word, font, size) > width {
+			flush()
+		}
+		// break words that don't fit on a line at all, like long urls
+		for textWidth(word, font, size) > width {
+			i := 1
+			for textWidth(word[:i+1], font, size) <= width {
+				i++
+			}
+			line = word[:i]
+			flush()
+			word = word[i:]
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	if line != "" {
+		flush()
+	}
+}
+
+func (d *document) heading(s string) {
+	d.ensure(60)
+	d.space(12)
+	d.paragraph(s, bold, 14, 0, 0)
+	d.space(4)
+}
+
+// graph draws the graph on a page of its own, scaled to fit
+func (d *document) graph(c Card) {
+	d.newPage()
+	d.paragraph("Graph", bold, 14, 0, 0)
+	boxes, width, height := c.Graph.Layout()
+	top := d.y - 12
+	scale := math.Min(1, math.Min((pageWidth-2*margin)/width, (top-margin)/height))
+	left := margin + (pageWidth-2*margin-width*scale)/2
+	x := func(v float64) float64 { return left + v*scale }
+	y := func(v float64) float64 { return top - v*scale }
+
+	fmt.Fprintf(d.page, "0 G 0 g %.2f w\n", 0.8*scale)
+	for _, edge := range c.Graph.Edges {
+		from, to := boxes[edge.From], boxes[edge.To]
+		x1, y1 := x(from.X+from.Width/2), y(from.Y+from.Height)
+		x2, y2 := x(to.X+to.Width/2), y(to.Y)
+		fmt.Fprintf(d.page, "%.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+		// the arrow head
+		angle := math.Atan2(y2-y1, x2-x1)
+		size := 6 * scale
+		fmt.Fprintf(d.page, "%.2f %.2f m %.2f %.2f l %.2f %.2f l f\n", x2, y2,
+			x2-size*math.Cos(angle-0.4), y2-size*math.Sin(angle-0.4),
+			x2-size*math.Cos(angle+0.4), y2-size*math.Sin(angle+0.4))
+		label := encode(edge.Label())
+		labelSize := math.Max(4, 8*scale)
+		d.text((x1+x2)/2-textWidth(label, regular, labelSize)/2, (y1+y2)/2, regular, labelSize, 0.3, label)
+	}
+	for _, node := range c.Graph.Nodes {
+		box := boxes[node.Name]
+		bx, by, bw, bh := x(box.X), y(box.Y+box.Height), box.Width*scale, box.Height*scale
+		if node.Made {
+			fmt.Fprintf(d.page, "%.2f w 1 g %.2f %.2f %.2f %.2f re B\n", 1.5*scale, bx, by, bw, bh)
+		} else {
+			// an ellipse from four curves
+			cx, cy, rx, ry := bx+bw/2, by+bh/2, bw/2, bh/2
+			k := 0.5523
+			fmt.Fprintf(d.page, "%.2f w [3 2] 0 d 1 g %.2f %.2f m ", 0.8*scale, cx+rx, cy)
+			fmt.Fprintf(d.page, "%.2f %.2f %.2f %.2f %.2f %.2f c ", cx+rx, cy+k*ry, cx+k*rx, cy+ry, cx, cy+ry)
+			fmt.Fprintf(d.page, "%.2f %.2f %.2f %.2f %.2f %.2f c ", cx-k*rx, cy+ry, cx-rx, cy+k*ry, cx-rx, cy)
+			fmt.Fprintf(d.page, "%.2f %.2f %.2f %.2f %.2f %.2f c ", cx-rx, cy-k*ry, cx-k*rx, cy-ry, cx, cy-ry)
+			fmt.Fprintf(d.page, "%.2f %.2f %.2f %.2f %.2f %.2f c B [] 0 d\n", cx+k*rx, cy-ry, cx+rx, cy-k*ry, cx+rx, cy)
+		}
+		name := encode(node.Name)
+		size := math.Max(4, 11*scale)
+		d.text(bx+bw/2-textWidth(name, regular, size)/2, by+bh/2-size/3, regular, size, 0, name)
+	}
+}
+
+// notes writes the notes of an item, with the urls of the links
+func (d *document) notes(lines [][]recipe.NoteLink) {
+	for _, line := range lines {
+		parts := []string{}
+		for _, link := range line {
+			if link.URL != "" && link.URL != link.Text {
+				parts = append(parts, link.Text+" <"+link.URL+">")
+			} else {
+				parts = append(parts, link.Text)
+			}
+		}
+		d.paragraph(strings.Join(parts, ""), regular, 8, 14, 0.4)
+	}
+}
+
+// PDF writes the card as a PDF
+func (c Card) PDF(w io.Writer) (err error) {
+	d := &document{}
+	d.newPage()
+	d.paragraph(c.Title, bold, 22, 0, 0)
+	d.space(4)
+	d.paragraph(c.Quantity+" - "+c.Cost+" - "+c.Time, regular, 11, 0, 0.3)
+	if c.Servings != "" {
+		d.paragraph(c.Servings, regular, 11, 0, 0.3)
+	}
+	if c.Start != "" {
+		d.paragraph("Start "+c.Start+", ready "+c.Ready, regular, 11, 0, 0.3)
+	}
+
+	d.heading("Buy")
+	for _, item := range c.Buy {
+		d.ensure(30)
+		d.paragraph("• "+item.Amount+" "+item.Name+" ("+item.Cost+")", bold, 10, 0, 0)
+		if item.Why != "" {
+			d.paragraph(item.Why, regular, 9, 14, 0.3)
+		}
+		if item.Scratch != "" {
+			d.paragraph(item.Scratch, regular, 9, 14, 0.3)
+		}
+		d.notes(item.Notes)
+		d.space(3)
+	}
+
+	if len(c.Make) > 0 {
+		d.heading("Make")
+		for _, item := range c.Make {
+			d.ensure(30)
+			d.paragraph("• "+item.Amount+" "+item.Name, bold, 10, 0, 0)
+			if item.Why != "" {
+				d.paragraph(item.Why, regular, 9, 14, 0.3)
+			}
+			d.space(3)
+		}
+
+		d.heading("Directions")
+		for i, step := range c.Steps {
+			d.ensure(40)
+			title := fmt.Sprintf("%d. Make %s", i+1, step.Name)
+			if step.Time != "" {
+				title += " (" + strings.ToLower(step.Time) + ")"
+			}
+			d.paragraph(title, bold, 11, 0, 0)
+			if step.Start != "" {
+				d.paragraph(step.Start+" to "+step.Ready, regular, 9, 14, 0.3)
+			}
+			for _, text := range step.Texts {
+				d.paragraph(text, regular, 10, 14, 0)
+				d.space(3)
+			}
+			d.space(4)
+		}
+	}
+	d.graph(c)
+	return d.write(w)
+}
+
+// write writes the objects of the document, and the table of where they
+// are
+func (d *document) write(w io.Writer) (err error) {
+	var b bytes.Buffer
+	offsets := []int{}
+	object := func(format string, args ...interface{}) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(&b, format, args...)
+		b.WriteString("\nendobj\n")
+	}
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// the catalog, the pages and the fonts come first, and then each page
+	// and its contents
+	kids := []string{}
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %g %g] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, regular, bold, 6+2*i)
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(page.Bytes())
+		zw.Close()
+		object("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.String())
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err = w.Write(b.Bytes())
+	return
+}
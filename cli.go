@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/card"
+	"github.com/schollz/recursive-recipes/cooklang"
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/schollz/recursive-recipes/schema"
+)
+
+// commands are run instead of the server, e.g.
+//
+//	recursive-recipes plan pancakes --minutes 60 --make butter
+//	recursive-recipes graph pancakes --format mermaid
+//	recursive-recipes print pancakes --format pdf > pancakes.pdf
+//	recursive-recipes import saved/*.html cook/*.cook > imported.toml
+//	recursive-recipes export --dir cook
+var commands = map[string]func(args []string) error{
+	"plan":   planCommand,
+	"graph":  graphCommand,
+	"print":  printCommand,
+	"import": importCommand,
+	"export": exportCommand,
+}
+
+func runCommand(args []string) {
+	command, ok := commands[args[0]]
+	if !ok {
+		names := []string{}
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "unknown command %s, the commands are %s\n", args[0], strings.Join(names, ", "))
+		os.Exit(2)
+	}
+	// the output is for reading (or for scripts), so keep the logs out of it
+	recipe.SetLogLevel("critical")
+	if err := command(args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses the flags, which can be anywhere in the arguments, and
+// returns the other arguments joined into the name of the recipe
+func parseArgs(fs *flag.FlagSet, args []string) (recipeName string, err error) {
+	words := []string{}
+	for {
+		if err = fs.Parse(args); err != nil {
+			return
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		words = append(words, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	recipeName = unslugify(strings.Join(words, " "))
+	if recipeName == "" {
+		err = fmt.Errorf("usage: recursive-recipes %s [flags] <recipe>", fs.Name())
+	}
+	return
+}
+
+// listFlag is a flag that can be repeated, or given a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// requestFlags adds the flags of a request to the flag set
+func requestFlags(fs *flag.FlagSet) func(recipeName string) recipe.RequestFromApp {
+	amount := fs.Float64("amount", 0, "amount of the recipe (default the amount of its reaction)")
+	minutes := fs.Float64("minutes", 0, "minutes to spend making things")
+	var toMake, diet listFlag
+	fs.Var(&toMake, "make", "ingredient to make instead of buying, can be repeated (the recipe itself is always made)")
+	fs.Var(&diet, "diet", "diet the plan must comply with, can be repeated")
+	return func(recipeName string) (request recipe.RequestFromApp) {
+		request = recipe.RequestFromApp{
+			Recipe:             recipeName,
+			Amount:             *amount,
+			MinutesToBuild:     *minutes,
+			Diet:               diet,
+			IngredientsToBuild: map[string]struct{}{recipeName: {}},
+			NoGraph:            true,
+		}
+		for _, ing := range toMake {
+			request.IngredientsToBuild[ing] = struct{}{}
+		}
+		return
+	}
+}
+
+// planCommand prints the plan for a recipe
+func planCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the plan as json")
+	request := requestFlags(fs)
+	recipeName, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	plan, err := recipe.GetPlan(request(recipeName))
+	if err != nil {
+		return
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	}
+	printPlan(os.Stdout, plan)
+	return
+}
+
+// printPlan writes the plan as text
+func printPlan(w io.Writer, plan recipe.Plan) {
+	payload := plan.UpdateApp()
+	fmt.Fprintf(w, "%s, %s\n", strings.Title(plan.Recipe), recipe.FormatMeasure(payload.Amount, payload.Measure))
+	fmt.Fprintf(w, "Total cost: $%2.2f\n", float64(plan.CostCents)/100)
+	fmt.Fprintf(w, "Total time: %s\n", payload.TotalTime)
+
+	fmt.Fprintln(w, "\nIngredients to buy:")
+	for _, ing := range payload.Ingredients {
+		fmt.Fprintf(w, "  - %s %s (%s)\n", ing.Amount, ing.Name, ing.Cost)
+	}
+	if len(payload.Directions) > 0 {
+		fmt.Fprintln(w, "\nIngredients to make:")
+		for _, direction := range payload.Directions {
+			fmt.Fprintf(w, "  - %s\n", direction.Name)
+		}
+		fmt.Fprintln(w, "\nDirections:")
+		for i, direction := range payload.Directions {
+			fmt.Fprintf(w, "  %d. Make %s", i+1, direction.Name)
+			if direction.TotalTime != "" {
+				fmt.Fprintf(w, " (%s)", strings.ToLower(direction.TotalTime))
+			}
+			fmt.Fprintln(w)
+			for _, text := range direction.Texts {
+				fmt.Fprintf(w, "     %s\n", text)
+			}
+		}
+	}
+
+	fmt.Fprintln(w, "\nTree:")
+	fmt.Fprint(w, recipe.PlanTree(plan))
+}
+
+// graphCommand prints the graph of the plan for a recipe
+func graphCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("graph", flag.ContinueOnError)
+	format := fs.String("format", "dot", "format of the graph: dot, svg, mermaid or json")
+	themeName := fs.String("theme", "app", "theme of the graph: app, light or dark")
+	request := requestFlags(fs)
+	recipeName, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	theme, err := recipe.GetTheme(*themeName)
+	if err != nil {
+		return
+	}
+	if _, ok := recipe.ExportFormats[*format]; !ok {
+		return fmt.Errorf("unknown format %s", *format)
+	}
+	plan, err := recipe.GetPlan(request(recipeName))
+	if err != nil {
+		return
+	}
+	return recipe.ExportGraph(context.Background(), recipe.PlanGraph(plan), *format, theme, os.Stdout)
+}
+
+// printCommand prints the recipe card of the plan for a recipe
+func printCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("print", flag.ContinueOnError)
+	format := fs.String("format", "html", "format of the card: html or pdf")
+	request := requestFlags(fs)
+	recipeName, err := parseArgs(fs, args)
+	if err != nil {
+		return
+	}
+	plan, err := recipe.GetPlan(request(recipeName))
+	if err != nil {
+		return
+	}
+	switch *format {
+	case "html":
+		return card.New(plan).HTML(os.Stdout)
+	case "pdf":
+		return card.New(plan).PDF(os.Stdout)
+	}
+	return fmt.Errorf("unknown format %s", *format)
+}
+
+// importCommand converts Cooklang files, and the schema.org Recipes in
+// saved HTML pages, into reactions, and reports the ingredients that have
+// to be added by hand
+func importCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write the reactions to (default stdout)")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("usage: recursive-recipes import [flags] <page.html|recipe.cook>...")
+	}
+	var imported recipe.Reactions
+	for _, fname := range fs.Args() {
+		var page []byte
+		page, err = ioutil.ReadFile(fname)
+		if err != nil {
+			return
+		}
+		if filepath.Ext(fname) == ".cook" {
+			var reaction recipe.Reaction
+			reaction, err = cooklang.Parse(string(page))
+			if err != nil {
+				return fmt.Errorf("%s: %w", fname, err)
+			}
+			imported.Reactions = append(imported.Reactions, reaction)
+			fmt.Fprintf(os.Stderr, "%s: %s, %d ingredients\n", fname, reaction.Product[0].Name, len(reaction.Reactant))
+			continue
+		}
+		var recipes []schema.Recipe
+		recipes, err = schema.Extract(page)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fname, err)
+		}
+		for _, r := range recipes {
+			reaction, unparsed := schema.Reaction(r)
+			imported.Reactions = append(imported.Reactions, reaction)
+			fmt.Fprintf(os.Stderr, "%s: %s, %d ingredients", fname, reaction.Product[0].Name, len(reaction.Reactant))
+			if len(unparsed) > 0 {
+				fmt.Fprintf(os.Stderr, ", %d to review:", len(unparsed))
+			}
+			fmt.Fprintln(os.Stderr)
+			for _, u := range unparsed {
+				fmt.Fprintf(os.Stderr, "  - %s (%s)\n", u.Line, u.Reason)
+			}
+		}
+	}
+	if *out == "" {
+		return recipe.WriteCatalog(os.Stdout, imported)
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return
+	}
+	if err = recipe.WriteCatalog(f, imported); err != nil {
+		f.Close()
+		return
+	}
+	return f.Close()
+}
+
+// exportCommand writes the reactions of the catalog as Cooklang, either
+// the reactions of the recipes to stdout or every reaction to a directory
+func exportCommand(args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory to write a .cook file for each reaction to")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if fs.NArg() == 0 && *dir == "" {
+		return fmt.Errorf("usage: recursive-recipes export [--dir dir] [recipe...]")
+	}
+	catalog, err := recipe.LoadCatalog(recipe.CatalogFile)
+	if err != nil {
+		return
+	}
+	names := make(map[string]bool)
+	for _, name := range fs.Args() {
+		names[unslugify(name)] = false
+	}
+	if *dir != "" {
+		if err = os.MkdirAll(*dir, 0755); err != nil {
+			return
+		}
+	}
+	// the other ways to make a product are numbered, e.g. pie-crust_2.cook,
+	// which sorts after pie-crust.cook so that it is imported after it
+	all := len(names) == 0
+	files := make(map[string]int)
+	for _, reaction := range catalog.Reactions {
+		if len(reaction.Product) == 0 {
+			continue
+		}
+		name := reaction.Product[0].Name
+		if _, ok := names[name]; !ok && !all {
+			continue
+		}
+		names[name] = true
+		if *dir == "" {
+			if err = cooklang.Write(os.Stdout, reaction); err != nil {
+				return
+			}
+			continue
+		}
+		files[name]++
+		fname := slugify(name)
+		if files[name] > 1 {
+			fname += fmt.Sprintf("_%d", files[name])
+		}
+		fname = filepath.Join(*dir, fname+".cook")
+		if err = ioutil.WriteFile(fname, []byte(cooklang.Format(reaction)), 0644); err != nil {
+			return
+		}
+		fmt.Fprintln(os.Stderr, fname)
+	}
+	for name, found := range names {
+		if !found {
+			return fmt.Errorf("no reaction makes %s", name)
+		}
+	}
+	return
+}
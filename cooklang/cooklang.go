@@ -0,0 +1,313 @@
+// Package cooklang converts between reactions and Cooklang
+// (https://cooklang.org), which is easier to write than the toml of the
+// catalog.
+//
+// The reactants are the ingredients, e.g. @brown sugar{0.5%cup}, with their
+// notes in parentheses after them. Reactants that the directions don't
+// mention are listed in a step of their own. A ~wait timer (or ~parallel)
+// is parallel time and every other timer is serial time, so
+//
+//	~prep{30%minutes} ~wait{1%hour}
+//
+// is s_hours = 0.5 and p_hours = 1.0. Everything else is metadata, where
+// the lines after >> product: name{amount%unit} describe that product
+// (except for the metadata only a reaction has, like the title).
+package cooklang
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// Write writes the reaction as Cooklang
+func Write(w io.Writer, reaction recipe.Reaction) (err error) {
+	_, err = io.WriteString(w, Format(reaction))
+	return
+}
+
+// Format returns the reaction as Cooklang
+func Format(reaction recipe.Reaction) string {
+	var b strings.Builder
+	meta := func(key, value string) {
+		fmt.Fprintf(&b, ">> %s:", key)
+		if value != "" {
+			b.WriteString(" " + value)
+		}
+		b.WriteString("\n")
+	}
+	metaString := func(key, value string) {
+		if value = cleanText(value); value != "" {
+			meta(key, quote(value))
+		}
+	}
+	metaFloat := func(key string, value float64) {
+		if value != 0 {
+			meta(key, formatFloat(value))
+		}
+	}
+
+	metaString("title", reaction.Title)
+	metaString("description", reaction.Description)
+	metaString("category", reaction.Category)
+	metaString("image", reaction.Image)
+	if reaction.Published {
+		meta("published", "true")
+	}
+	if reaction.Featured {
+		meta("featured", "true")
+	}
+	if !reaction.LastUpdated.IsZero() {
+		meta("updated", reaction.LastUpdated.Format(time.RFC3339))
+	}
+	metaFloat("s_hours_min", reaction.SerialHoursMin)
+	metaFloat("s_hours_max", reaction.SerialHoursMax)
+	metaFloat("p_hours_min", reaction.ParallelHoursMin)
+	metaFloat("p_hours_max", reaction.ParallelHoursMax)
+	if reaction.Footprint != nil {
+		meta("footprint", formatFootprint(*reaction.Footprint))
+	}
+	if reaction.Season != nil {
+		months := make([]string, len(reaction.Season.Months))
+		for i, month := range reaction.Season.Months {
+			months[i] = strconv.Itoa(month)
+		}
+		meta("months", strings.Join(months, ", "))
+		metaFloat("harvest_lag", reaction.Season.HarvestLag)
+	}
+	metaString("notes", reaction.Notes)
+	for _, product := range reaction.Product {
+		meta("product", product.Name+formatAmount(product))
+		metaFloat("price", product.Price)
+		metaFloat("price_min", product.PriceMin)
+		metaFloat("price_max", product.PriceMax)
+		metaFloat("servings", product.Servings)
+		metaString("serving_size", product.ServingSize)
+		if product.FoodDataID != 0 {
+			meta("fdc_id", strconv.Itoa(product.FoodDataID))
+		}
+		metaFloat("grams", product.Grams)
+		if product.Tags != nil {
+			meta("tags", strings.Join(product.Tags, ", "))
+		}
+		if product.Nutrition != nil {
+			n := product.Nutrition
+			meta("nutrition", formatPairs([]string{"calories", "protein", "fat", "carbs", "fiber", "sodium"},
+				[]float64{n.Calories, n.Protein, n.Fat, n.Carbs, n.Fiber, n.Sodium}))
+		}
+		if product.Footprint != nil {
+			meta("footprint", formatFootprint(*product.Footprint))
+		}
+		metaString("notes", product.Notes)
+	}
+
+	steps := []string{}
+	lines := []string{}
+	for _, line := range strings.Split(reaction.Directions, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	mentioned := make([][]mention, len(lines))
+	unmentioned := []string{}
+	for _, reactant := range reaction.Reactant {
+		found := false
+		for i, line := range lines {
+			if start := findMention(line, reactant.Name, mentioned[i]); start >= 0 {
+				mentioned[i] = append(mentioned[i], mention{start, start + len(reactant.Name), reactant})
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmentioned = append(unmentioned, formatIngredient(reactant))
+		}
+	}
+	if len(unmentioned) > 0 {
+		steps = append(steps, strings.Join(unmentioned, ", "))
+	}
+	timers := []string{}
+	if reaction.SerialHours != 0 {
+		timers = append(timers, "~prep{"+formatFloat(reaction.SerialHours)+"%hours}")
+	}
+	if reaction.ParallelHours != 0 {
+		timers = append(timers, "~wait{"+formatFloat(reaction.ParallelHours)+"%hours}")
+	}
+	if len(timers) > 0 {
+		steps = append(steps, strings.Join(timers, " "))
+	}
+	for i, line := range lines {
+		steps = append(steps, formatStep(line, mentioned[i]))
+	}
+	for _, step := range steps {
+		b.WriteString("\n" + step + "\n")
+	}
+	return b.String()
+}
+
+// mention is where the directions mention a reactant
+type mention struct {
+	start, end int
+	reactant   recipe.Element
+}
+
+// findMention returns where the line first mentions the name as a whole
+// word, outside of the other mentions, or -1
+func findMention(line, name string, others []mention) int {
+	if name == "" {
+		return -1
+	}
+	for offset := 0; offset < len(line); {
+		i := strings.Index(line[offset:], name)
+		if i < 0 {
+			return -1
+		}
+		start, end := offset+i, offset+i+len(name)
+		offset = start + 1
+		if start > 0 && isWord(lastRune(line[:start])) || end < len(line) && isWord(firstRune(line[end:])) {
+			continue
+		}
+		overlaps := false
+		for _, other := range others {
+			if start < other.end && end > other.start {
+				overlaps = true
+			}
+		}
+		if !overlaps {
+			return start
+		}
+	}
+	return -1
+}
+
+// formatStep writes the line with its mentions as ingredients
+func formatStep(line string, mentions []mention) string {
+	sort.Slice(mentions, func(i, j int) bool {
+		return mentions[i].start < mentions[j].start
+	})
+	var b strings.Builder
+	last := 0
+	for _, m := range mentions {
+		b.WriteString(escape(line[last:m.start], last > 0))
+		b.WriteString(formatIngredient(m.reactant))
+		last = m.end
+	}
+	b.WriteString(escape(line[last:], last > 0))
+	return b.String()
+}
+
+func formatIngredient(e recipe.Element) (s string) {
+	s = "@" + e.Name + formatAmount(e)
+	notes := cleanText(e.Notes)
+	if notes == "" {
+		return
+	}
+	if strings.ContainsAny(notes, "\n\"") || !balanced(notes) {
+		return s + "(" + strconv.Quote(notes) + ")"
+	}
+	return s + "(" + notes + ")"
+}
+
+// formatAmount writes {amount%measure}, or just {amount} for whole things
+func formatAmount(e recipe.Element) string {
+	if e.Measure == "whole" || e.Measure == "" {
+		return "{" + formatFloat(e.Amount) + "}"
+	}
+	return "{" + formatFloat(e.Amount) + "%" + e.Measure + "}"
+}
+
+func formatFootprint(f recipe.Footprint) string {
+	return formatPairs([]string{"land", "water", "co2e", "energy"}, []float64{f.Land, f.Water, f.CO2e, f.Energy})
+}
+
+func formatPairs(keys []string, values []float64) string {
+	pairs := make([]string, len(keys))
+	for i := range keys {
+		pairs[i] = keys[i] + "=" + formatFloat(values[i])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// cleanText removes the space around text and its lines, which the toml
+// of the catalog has a lot of
+func cleanText(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quote quotes the value if it wouldn't be read back the same otherwise
+func quote(value string) string {
+	if strings.ContainsAny(value, "\n\r") || strings.TrimSpace(value) != value || strings.HasPrefix(value, `"`) {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// escape escapes what would be read as Cooklang in the text of a step. The
+// text right after an ingredient can't start with its notes.
+func escape(text string, afterIngredient bool) string {
+	var b strings.Builder
+	for i, r := range text {
+		next := text[i+len(string(r)):]
+		switch {
+		case r == '\\' || r == '@' || r == '#' || r == '~':
+			b.WriteRune('\\')
+		case r == '-' && strings.HasPrefix(next, "-"), r == '[' && strings.HasPrefix(next, "-"):
+			b.WriteRune('\\')
+		case r == '(' && i == 0 && afterIngredient:
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// balanced is whether the parentheses of the text are balanced, so that it
+// can be in parentheses
+func balanced(text string) bool {
+	depth := 0
+	for _, r := range text {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+	}
+	return depth == 0
+}
+
+func isWord(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func firstRune(s string) rune {
+	for _, r := range s {
+		return r
+	}
+	return 0
+}
+
+func lastRune(s string) rune {
+	runes := []rune(s)
+	if len(runes) == 0 {
+		return 0
+	}
+	return runes[len(runes)-1]
+}
@@ -0,0 +1,139 @@
+package cooklang
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var r recipe.Reactions
+	b, _ := ioutil.ReadFile("../recipes.toml")
+	_, err := toml.Decode(string(b), &r)
+	assert.Nil(t, err)
+	assert.True(t, len(r.Reactions) > 50)
+	for _, reaction := range r.Reactions {
+		cook := Format(reaction)
+		parsed, err := Parse(cook)
+		assert.Nil(t, err, cook)
+		// the reactants that the directions mention are in the order
+		// they are mentioned
+		assert.ElementsMatch(t, clean(reaction).Reactant, parsed.Reactant, cook)
+		parsed.Reactant = reaction.Reactant
+		assert.Equal(t, clean(reaction), clean(parsed), cook)
+		assert.Equal(t, cook, Format(parsed))
+	}
+}
+
+// clean removes the space around the text, like Format does, and the
+// blank lines of the directions
+func clean(reaction recipe.Reaction) recipe.Reaction {
+	lines := []string{}
+	for _, line := range strings.Split(reaction.Directions, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	reaction.Directions = ""
+	if len(lines) > 0 {
+		reaction.Directions = strings.Join(lines, "\n") + "\n"
+	}
+	reaction.Notes = cleanText(reaction.Notes)
+	reaction.Product = cleanElements(reaction.Product)
+	reaction.Reactant = cleanElements(reaction.Reactant)
+	return reaction
+}
+
+func cleanElements(elements []recipe.Element) []recipe.Element {
+	cleaned := make([]recipe.Element, len(elements))
+	for i, e := range elements {
+		e.Notes = cleanText(e.Notes)
+		cleaned[i] = e
+	}
+	return cleaned
+}
+
+func TestFormat(t *testing.T) {
+	reaction := recipe.Reaction{
+		Title:         "Toast",
+		SerialHours:   0.25,
+		ParallelHours: 0.05,
+		Directions:    "Toast the bread, then spread the butter.\nEat it -- quickly @ home.\n",
+		Product:       []recipe.Element{{Name: "toast", Amount: 2, Measure: "whole", Tags: []string{}}},
+		Reactant: []recipe.Element{
+			{Name: "bread", Amount: 2, Measure: "whole"},
+			{Name: "butter", Amount: 1, Measure: "tablespoon", Notes: "[salted](https://example.com/butter)"},
+			{Name: "salt", Amount: 0.125, Measure: "tsp"},
+		},
+	}
+	assert.Equal(t, `>> title: Toast
+>> product: toast{2}
+>> tags:
+
+@salt{0.125%tsp}
+
+~prep{0.25%hours} ~wait{0.05%hours}
+
+Toast the @bread{2}, then spread the @butter{1%tablespoon}([salted](https://example.com/butter)).
+
+Eat it \-- quickly \@ home.
+`, Format(reaction))
+}
+
+func TestParse(t *testing.T) {
+	reaction, err := Parse(`>> title: Pancakes
+>> source: grandma
+>> product: pancakes{12}
+>> servings: 4
+>> serving_size: 3 pancakes
+>> tags: gluten, dairy
+
+-- a comment
+Whisk the @flour{1 1/2 % cups} [- and a block comment -]and @baking powder{1/4%cup}
+in a #bowl{}.
+
+Add the @egg{1} and @milk{1.25%cup}(cold), then rest for ~rest{10%minutes}.
+
+Cook for ~{2%minutes} on each side, and ~wait{0.5%hours} to cool.
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, "Pancakes", reaction.Title)
+	assert.Equal(t, []recipe.Element{{Name: "pancakes", Amount: 12, Measure: "whole", Servings: 4, ServingSize: "3 pancakes", Tags: []string{"gluten", "dairy"}}}, reaction.Product)
+	assert.Equal(t, []recipe.Element{
+		{Name: "flour", Amount: 1.5, Measure: "cup"},
+		{Name: "baking powder", Amount: 0.25, Measure: "cup"},
+		{Name: "egg", Amount: 1, Measure: "whole"},
+		{Name: "milk", Amount: 1.25, Measure: "cup", Notes: "cold"},
+	}, reaction.Reactant)
+	assert.InDelta(t, 12.0/60, reaction.SerialHours, 0.0001)
+	assert.Equal(t, 0.5, reaction.ParallelHours)
+	assert.Equal(t, `Whisk the flour and baking powder in a bowl.
+Add the egg and milk, then rest for 10 minutes.
+Cook for 2 minutes on each side, and 0.5 hours to cool.
+`, reaction.Directions)
+
+	for _, bad := range []string{
+		"Mix the @flour{2%cup}.",
+		">> product: bread\n",
+		">> product: bread{1}\n\nAdd @flour.",
+		">> product: bread{1}\n\nAdd @flour{2%kg}.",
+		">> product: bread{1}\n\nBake for ~{20}.",
+		">> product: bread{1}\n>> price: cheap\n",
+		">> product: bread{1}\n>> published: maybe\n",
+	} {
+		_, err := Parse(bad)
+		assert.NotNil(t, err, bad)
+	}
+
+	// the metadata of the reaction can come after a product
+	reaction, err = Parse(">> product: bread{1}\n>> price: 3\n>> title: Bread\n>> published: true\n>> months: 1, 2\n>> source: grandma\n\nBake @flour{2%cup}.")
+	assert.Nil(t, err)
+	assert.Equal(t, "Bread", reaction.Title)
+	assert.True(t, reaction.Published)
+	assert.Equal(t, []int{1, 2}, reaction.Season.Months)
+	assert.Equal(t, []recipe.Element{{Name: "bread", Amount: 1, Measure: "whole", Price: 3}}, reaction.Product)
+}
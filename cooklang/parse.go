@@ -0,0 +1,480 @@
+package cooklang
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/schollz/recursive-recipes/ingredient"
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// hoursPerUnit are the units of timers
+var hoursPerUnit = map[string]float64{
+	"s": 1.0 / 3600, "sec": 1.0 / 3600, "second": 1.0 / 3600, "seconds": 1.0 / 3600,
+	"m": 1.0 / 60, "min": 1.0 / 60, "mins": 1.0 / 60, "minute": 1.0 / 60, "minutes": 1.0 / 60,
+	"h": 1, "hr": 1, "hrs": 1, "hour": 1, "hours": 1,
+	"d": 24, "day": 24, "days": 24,
+	"week": 168, "weeks": 168,
+}
+
+// Parse reads a reaction from Cooklang
+func Parse(text string) (reaction recipe.Reaction, err error) {
+	text = removeBlockComments(strings.Replace(text, "\r\n", "\n", -1))
+	var product *recipe.Element
+	steps := []string{}
+	step := []string{}
+	endStep := func() {
+		if len(step) > 0 {
+			steps = append(steps, strings.Join(step, " "))
+			step = []string{}
+		}
+	}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.HasPrefix(line, ">>") {
+			endStep()
+			if err = parseMetadata(&reaction, &product, line[2:]); err != nil {
+				err = fmt.Errorf("line %d: %w", n, err)
+				return
+			}
+			continue
+		}
+		line = strings.TrimSpace(removeComment(line))
+		if line == "" {
+			endStep()
+			continue
+		}
+		step = append(step, line)
+	}
+	endStep()
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(reaction.Product) == 0 {
+		err = fmt.Errorf("no product, which is given by >> product: name{amount%%measure}")
+		return
+	}
+
+	directions := []string{}
+	for _, s := range steps {
+		var direction string
+		direction, err = parseStep(&reaction, s)
+		if err != nil {
+			return
+		}
+		if direction != "" {
+			directions = append(directions, direction)
+		}
+	}
+	if len(directions) > 0 {
+		reaction.Directions = strings.Join(directions, "\n") + "\n"
+	}
+	return
+}
+
+// parseMetadata reads a line of metadata, where the lines after a product
+// describe that product
+func parseMetadata(reaction *recipe.Reaction, product **recipe.Element, line string) (err error) {
+	parts := strings.SplitN(line, ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("metadata needs a key and a value: %q", line)
+	}
+	key := strings.ToLower(strings.TrimSpace(parts[0]))
+	value := strings.TrimSpace(parts[1])
+	if strings.HasPrefix(value, `"`) {
+		if value, err = strconv.Unquote(value); err != nil {
+			return fmt.Errorf("%s: bad quoted value", key)
+		}
+	}
+
+	if key == "product" {
+		var e recipe.Element
+		if e, err = parseProduct(value); err != nil {
+			return
+		}
+		reaction.Product = append(reaction.Product, e)
+		*product = &reaction.Product[len(reaction.Product)-1]
+		return
+	}
+	if *product != nil {
+		var known bool
+		if known, err = parseProductMetadata(*product, key, value); known {
+			return
+		}
+		// the other metadata is of the reaction, wherever it is
+	}
+	switch key {
+	case "title":
+		reaction.Title = value
+	case "description":
+		reaction.Description = value
+	case "category":
+		reaction.Category = value
+	case "image":
+		reaction.Image = value
+	case "notes":
+		reaction.Notes = value
+	case "published":
+		reaction.Published, err = strconv.ParseBool(value)
+	case "featured":
+		reaction.Featured, err = strconv.ParseBool(value)
+	case "updated":
+		reaction.LastUpdated, err = time.Parse(time.RFC3339, value)
+	case "s_hours_min":
+		reaction.SerialHoursMin, err = strconv.ParseFloat(value, 64)
+	case "s_hours_max":
+		reaction.SerialHoursMax, err = strconv.ParseFloat(value, 64)
+	case "p_hours_min":
+		reaction.ParallelHoursMin, err = strconv.ParseFloat(value, 64)
+	case "p_hours_max":
+		reaction.ParallelHoursMax, err = strconv.ParseFloat(value, 64)
+	case "footprint":
+		reaction.Footprint = new(recipe.Footprint)
+		err = parseFootprint(reaction.Footprint, value)
+	case "months":
+		if reaction.Season == nil {
+			reaction.Season = new(recipe.Season)
+		}
+		for _, month := range splitList(value) {
+			var m int
+			if m, err = strconv.Atoi(month); err != nil {
+				break
+			}
+			reaction.Season.Months = append(reaction.Season.Months, m)
+		}
+	case "harvest_lag":
+		if reaction.Season == nil {
+			reaction.Season = new(recipe.Season)
+		}
+		reaction.Season.HarvestLag, err = strconv.ParseFloat(value, 64)
+	default:
+		// other metadata, like the source, is for people
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", key, err)
+	}
+	return
+}
+
+// parseProductMetadata reads the metadata of a product, and whether the key
+// is one of a product
+func parseProductMetadata(product *recipe.Element, key, value string) (known bool, err error) {
+	known = true
+	switch key {
+	case "price":
+		product.Price, err = strconv.ParseFloat(value, 64)
+	case "price_min":
+		product.PriceMin, err = strconv.ParseFloat(value, 64)
+	case "price_max":
+		product.PriceMax, err = strconv.ParseFloat(value, 64)
+	case "servings":
+		product.Servings, err = strconv.ParseFloat(value, 64)
+	case "serving_size":
+		product.ServingSize = value
+	case "fdc_id":
+		product.FoodDataID, err = strconv.Atoi(value)
+	case "grams":
+		product.Grams, err = strconv.ParseFloat(value, 64)
+	case "tags":
+		product.Tags = splitList(value)
+	case "nutrition":
+		n := new(recipe.Nutrition)
+		err = parsePairs(value, map[string]*float64{
+			"calories": &n.Calories, "protein": &n.Protein, "fat": &n.Fat,
+			"carbs": &n.Carbs, "fiber": &n.Fiber, "sodium": &n.Sodium,
+		})
+		product.Nutrition = n
+	case "footprint":
+		product.Footprint = new(recipe.Footprint)
+		err = parseFootprint(product.Footprint, value)
+	case "notes":
+		product.Notes = value
+	default:
+		known = false
+	}
+	if err != nil {
+		err = fmt.Errorf("%s of %s: %w", key, product.Name, err)
+	}
+	return
+}
+
+func parseFootprint(f *recipe.Footprint, value string) error {
+	return parsePairs(value, map[string]*float64{
+		"land": &f.Land, "water": &f.Water, "co2e": &f.CO2e, "energy": &f.Energy,
+	})
+}
+
+// parsePairs reads "key=value, key=value" into the fields
+func parsePairs(value string, fields map[string]*float64) (err error) {
+	for _, pair := range splitList(value) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("%q isn't key=value", pair)
+		}
+		field, ok := fields[strings.TrimSpace(kv[0])]
+		if !ok {
+			return fmt.Errorf("unknown %q", kv[0])
+		}
+		if *field, err = strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// splitList splits a comma-separated list, where nothing is an empty list
+func splitList(value string) (items []string) {
+	items = []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// parseProduct reads "name{amount%measure}"
+func parseProduct(value string) (e recipe.Element, err error) {
+	i := strings.Index(value, "{")
+	if i < 0 || !strings.HasSuffix(value, "}") {
+		err = fmt.Errorf("product %q needs an amount, like %s{1%%cup}", value, value)
+		return
+	}
+	e.Name = strings.TrimSpace(value[:i])
+	e.Amount, e.Measure, err = parseQuantity(e.Name, value[i+1:len(value)-1])
+	return
+}
+
+// parseQuantity reads "amount%unit" of an ingredient. The measures of the
+// catalog are kept as they are and other units, like ml or cups, are
+// converted to them.
+func parseQuantity(name, quantity string) (amount float64, measure string, err error) {
+	parts := strings.SplitN(quantity, "%", 2)
+	amount, err = parseAmount(parts[0])
+	if err != nil {
+		err = fmt.Errorf("%s needs an amount: %w", name, err)
+		return
+	}
+	unit := ""
+	if len(parts) == 2 {
+		unit = strings.TrimSpace(parts[1])
+	}
+	if unit == "" {
+		return amount, "whole", nil
+	}
+	if recipe.IsMeasure(strings.ToLower(unit)) {
+		return amount, strings.ToLower(unit), nil
+	}
+	measure, factor, ok := ingredient.ParseUnit(unit)
+	if !ok {
+		err = fmt.Errorf("%s is measured in %s, which isn't a measure of the catalog", name, unit)
+		return
+	}
+	return amount * factor, measure, nil
+}
+
+// parseAmount reads "2", "0.5", "1/2", "1 1/2" or "1½"
+func parseAmount(s string) (amount float64, err error) {
+	amount, ok := ingredient.ParseAmount(s)
+	if !ok {
+		err = fmt.Errorf("%q isn't a number", strings.TrimSpace(s))
+	}
+	return
+}
+
+// parseStep adds the ingredients and timers of the step to the reaction,
+// and returns the text of the step. Steps with only ingredients and
+// timers have no text.
+func parseStep(reaction *recipe.Reaction, step string) (text string, err error) {
+	var b strings.Builder
+	hasText := false
+	runes := []rune(step)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\\' && i+1 < len(runes) {
+			i++
+			b.WriteRune(runes[i])
+			hasText = true
+			continue
+		}
+		if r != '@' && r != '#' && r != '~' {
+			b.WriteRune(r)
+			if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+				hasText = true
+			}
+			continue
+		}
+		name, quantity, end, hasQuantity := readToken(runes, i+1)
+		switch r {
+		case '@':
+			if !hasQuantity {
+				err = fmt.Errorf("%s needs an amount, like @%s{1%%cup}", name, name)
+				return
+			}
+			e := recipe.Element{Name: name}
+			if e.Amount, e.Measure, err = parseQuantity(name, quantity); err != nil {
+				return
+			}
+			if end < len(runes) && runes[end] == '(' {
+				if e.Notes, end, err = readNotes(runes, end); err != nil {
+					err = fmt.Errorf("notes of %s: %w", name, err)
+					return
+				}
+			}
+			reaction.Reactant = append(reaction.Reactant, e)
+			b.WriteString(name)
+		case '#':
+			b.WriteString(name)
+			hasText = true
+		case '~':
+			var hours float64
+			if hours, err = parseTimer(quantity); err != nil {
+				err = fmt.Errorf("timer %s: %w", name, err)
+				return
+			}
+			if name == "wait" || name == "parallel" {
+				reaction.ParallelHours += hours
+			} else {
+				reaction.SerialHours += hours
+			}
+			b.WriteString(strings.Replace(quantity, "%", " ", 1))
+		}
+		i = end - 1
+	}
+	if hasText {
+		text = b.String()
+	}
+	return
+}
+
+// readToken reads the name and the quantity in braces after @, # or ~. A
+// name with spaces ends at the braces, and a name without braces is one
+// word.
+func readToken(runes []rune, start int) (name, quantity string, end int, hasQuantity bool) {
+	brace := -1
+	for i := start; i < len(runes); i++ {
+		if runes[i] == '{' {
+			brace = i
+			break
+		}
+		if runes[i] == '@' || runes[i] == '#' || runes[i] == '~' {
+			break
+		}
+	}
+	if brace < 0 {
+		end = start
+		for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+			end++
+		}
+		name = string(runes[start:end])
+		return
+	}
+	closing := brace + 1
+	for closing < len(runes) && runes[closing] != '}' {
+		closing++
+	}
+	if closing == len(runes) {
+		end = start
+		return
+	}
+	return strings.TrimSpace(string(runes[start:brace])), string(runes[brace+1 : closing]), closing + 1, true
+}
+
+// readNotes reads the notes in parentheses, which are quoted if they
+// wouldn't be read back the same otherwise
+func readNotes(runes []rune, start int) (notes string, end int, err error) {
+	if start+1 < len(runes) && runes[start+1] == '"' {
+		for end = start + 2; end < len(runes); end++ {
+			if runes[end] == '\\' {
+				end++
+				continue
+			}
+			if runes[end] == '"' {
+				break
+			}
+		}
+		if end+1 >= len(runes) || runes[end+1] != ')' {
+			err = fmt.Errorf("unfinished notes")
+			return
+		}
+		notes, err = strconv.Unquote(string(runes[start+1 : end+1]))
+		end += 2
+		return
+	}
+	depth := 0
+	for end = start; end < len(runes); end++ {
+		switch runes[end] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth == 0 {
+			return string(runes[start+1 : end]), end + 1, nil
+		}
+	}
+	err = fmt.Errorf("unfinished notes")
+	return
+}
+
+// parseTimer returns the hours of "amount%unit"
+func parseTimer(quantity string) (hours float64, err error) {
+	parts := strings.SplitN(quantity, "%", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("needs a unit, like ~{10%%minutes}")
+		return
+	}
+	amount, err := parseAmount(parts[0])
+	if err != nil {
+		return
+	}
+	perUnit, ok := hoursPerUnit[strings.ToLower(strings.TrimSpace(parts[1]))]
+	if !ok {
+		err = fmt.Errorf("unknown unit %s", parts[1])
+		return
+	}
+	hours = amount * perUnit
+	return
+}
+
+// removeComment removes a -- comment, unless it is escaped
+func removeComment(line string) string {
+	for i := 0; i+1 < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '-' && line[i+1] == '-' {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// removeBlockComments removes [- comments -], unless they are escaped
+func removeBlockComments(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			b.WriteString(text[i : i+2])
+			i++
+			continue
+		}
+		if strings.HasPrefix(text[i:], "[-") {
+			end := strings.Index(text[i+2:], "-]")
+			if end < 0 {
+				break
+			}
+			i += end + 3
+			continue
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
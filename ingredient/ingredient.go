@@ -0,0 +1,309 @@
+// Package ingredient parses the ingredient lines of recipes, like
+// "1 1/2 cups all-purpose flour, sifted", into the elements of reactions.
+package ingredient
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// MinConfidence is the confidence below which a line should be checked
+// by someone before it is used
+const MinConfidence = 0.5
+
+// Line is an ingredient line and the element it describes. A range like
+// "2 to 3 cups" is the middle of the range, with its Min and Max.
+type Line struct {
+	Text        string         `json:"text"`
+	Element     recipe.Element `json:"element"`
+	Min         float64        `json:"min,omitempty"`
+	Max         float64        `json:"max,omitempty"`
+	Preparation string         `json:"preparation,omitempty"`
+
+	// Confidence is from 0 to 1, and Problems are why it is less than 1
+	Confidence float64  `json:"confidence"`
+	Problems   []string `json:"problems"`
+}
+
+// OK is whether the line can be used as a reactant without checking it
+func (l Line) OK() bool {
+	e := l.Element
+	return e.Name != "" && e.Amount > 0 && e.Measure != "" && l.Confidence >= MinConfidence
+}
+
+// unit is what a unit means to the catalog. Volumes are converted to the
+// measure, weights to grams, and counted units (like cloves) are whole.
+type unit struct {
+	measure string
+	factor  float64
+	grams   float64
+	counted bool
+}
+
+// units are the units by each of their names
+var units = map[string]unit{}
+
+func init() {
+	for _, u := range []struct {
+		names string
+		unit
+	}{
+		{"cup cups c", unit{measure: "cup", factor: 1}},
+		{"tablespoon tablespoons tbsp tbsps tbs tbl T", unit{measure: "tablespoon", factor: 1}},
+		{"teaspoon teaspoons tsp tsps t", unit{measure: "teaspoon", factor: 1}},
+		{"acre acres", unit{measure: "acre", factor: 1}},
+		{"whole", unit{measure: "whole", factor: 1}},
+		{"ml milliliter milliliters millilitre millilitres", unit{measure: "cup", factor: 1 / 236.5882365}},
+		{"l liter liters litre litres", unit{measure: "cup", factor: 1000 / 236.5882365}},
+		{"fl_oz floz fluid_ounce fluid_ounces", unit{measure: "cup", factor: 1.0 / 8}},
+		{"pint pints pt", unit{measure: "cup", factor: 2}},
+		{"quart quarts qt", unit{measure: "cup", factor: 4}},
+		{"gallon gallons gal", unit{measure: "cup", factor: 16}},
+		{"stick sticks", unit{measure: "cup", factor: 0.5}},
+		{"pinch pinches", unit{measure: "teaspoon", factor: 1.0 / 16}},
+		{"dash dashes", unit{measure: "teaspoon", factor: 1.0 / 8}},
+		{"g gram grams gr", unit{grams: 1}},
+		{"kg kilogram kilograms", unit{grams: 1000}},
+		{"oz ounce ounces", unit{grams: 28.349523125}},
+		{"lb lbs pound pounds", unit{grams: 453.59237}},
+		{"clove cloves can cans package packages pkg slice slices bunch bunches head heads", unit{measure: "whole", factor: 1, counted: true}},
+		{"piece pieces jar jars bottle bottles sprig sprigs handful handfuls", unit{measure: "whole", factor: 1, counted: true}},
+	} {
+		for _, name := range strings.Fields(u.names) {
+			units[strings.Replace(name, "_", " ", -1)] = u.unit
+		}
+	}
+}
+
+// ParseUnit returns the measure of the catalog for a unit like "Tbsp",
+// "cups" or "ml", and how much of the measure is in one of the unit. Units
+// that the catalog can't measure, like grams or cloves, aren't ok.
+func ParseUnit(s string) (measure string, factor float64, ok bool) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	u, ok := units[s]
+	if !ok {
+		u, ok = units[strings.ToLower(s)]
+	}
+	if !ok || u.measure == "" || u.counted {
+		return "", 0, false
+	}
+	return u.measure, u.factor, true
+}
+
+// fractions are the fractions that FormatCookingRational writes, and the
+// others that recipes use
+var fractions = map[rune]float64{
+	'⅛': 1.0 / 8, '¼': 1.0 / 4, '⅜': 3.0 / 8, '½': 1.0 / 2, '⅝': 5.0 / 8, '¾': 3.0 / 4, '⅞': 7.0 / 8,
+	'⅓': 1.0 / 3, '⅔': 2.0 / 3, '⅕': 1.0 / 5, '⅖': 2.0 / 5, '⅗': 3.0 / 5, '⅘': 4.0 / 5,
+	'⅙': 1.0 / 6, '⅚': 5.0 / 6, '⅐': 1.0 / 7, '⅑': 1.0 / 9, '⅒': 1.0 / 10,
+}
+
+// parseNumber parses "2", "1.5", "1/2" or "½"
+func parseNumber(s string) (value float64, ok bool) {
+	if runes := []rune(s); len(runes) == 1 {
+		if value, ok = fractions[runes[0]]; ok {
+			return
+		}
+	}
+	if i := strings.Index(s, "/"); i > 0 {
+		numerator, err1 := strconv.ParseFloat(s[:i], 64)
+		denominator, err2 := strconv.ParseFloat(s[i+1:], 64)
+		if err1 != nil || err2 != nil || denominator == 0 {
+			return 0, false
+		}
+		return numerator / denominator, true
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != '.' {
+			return 0, false
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	return value, err == nil
+}
+
+// readAmount reads a number, or a mixed number like "1 1/2" or "1 ½",
+// from the start of the words
+func readAmount(words []string) (amount float64, n int) {
+	whole, ok := parseNumber(words[0])
+	if !ok {
+		return 0, 0
+	}
+	if len(words) > 1 && !strings.Contains(words[0], "/") && !isFraction(words[0]) {
+		if fraction, ok := parseNumber(words[1]); ok && fraction < 1 && (strings.Contains(words[1], "/") || isFraction(words[1])) {
+			return whole + fraction, 2
+		}
+	}
+	return whole, 1
+}
+
+func isFraction(s string) bool {
+	runes := []rune(s)
+	_, ok := fractions[runes[0]]
+	return len(runes) == 1 && ok
+}
+
+// ParseAmount parses an amount like "2", "0.5", "1/2", "1 1/2" or "1 ½"
+func ParseAmount(s string) (amount float64, ok bool) {
+	words := strings.Fields(splitFractions(s))
+	if len(words) == 0 {
+		return
+	}
+	amount, n := readAmount(words)
+	return amount, n > 0 && n == len(words)
+}
+
+const fractionRunes = `⅛¼⅜½⅝¾⅞⅓⅔⅕⅖⅗⅘⅙⅚⅐⅑⅒`
+
+// the numbers glued to fractions, ranges or units, like "1½", "2-3" or
+// "200g", are split apart before the words are read
+var (
+	gluedFraction = regexp.MustCompile(`(\d)([` + fractionRunes + `])`)
+	gluedRange    = regexp.MustCompile(`([\d` + fractionRunes + `])\s*-\s*([\d` + fractionRunes + `])`)
+	gluedUnit     = regexp.MustCompile(`([\d` + fractionRunes + `])([a-zA-Z])`)
+)
+
+var parenthetical = regexp.MustCompile(`\(([^)]*)\)`)
+
+// approximately are the words that make an amount approximate
+var approximately = map[string]bool{
+	"about": true, "approximately": true, "approx": true, "approx.": true, "around": true,
+	"roughly": true, "scant": true, "heaping": true, "generous": true,
+}
+
+// preparationTail is what recipes add to the end of an ingredient instead
+// of after a comma
+var preparationTail = regexp.MustCompile(`\s+(to taste|for serving|for garnish|divided|optional|or more|or to taste|as needed)$`)
+
+func splitFractions(s string) string {
+	s = strings.NewReplacer("⁄", "/", "–", "-", "—", "-", "\u00a0", " ").Replace(s)
+	s = gluedFraction.ReplaceAllString(s, "$1 $2")
+	s = gluedRange.ReplaceAllString(s, "$1 - $2")
+	return s
+}
+
+// Parse parses an ingredient line
+func Parse(text string) (l Line) {
+	l = Line{Text: text, Confidence: 1, Problems: []string{}}
+	problem := func(penalty float64, p string) {
+		l.Confidence -= penalty
+		l.Problems = append(l.Problems, p)
+	}
+	defer func() {
+		l.Confidence = math.Max(0, math.Round(l.Confidence*100)/100)
+	}()
+
+	s := splitFractions(strings.TrimSpace(text))
+	s = strings.TrimLeft(s, "-*•▢ ")
+	notes := []string{}
+	for _, m := range parenthetical.FindAllStringSubmatch(s, -1) {
+		notes = append(notes, strings.TrimSpace(m[1]))
+	}
+	s = parenthetical.ReplaceAllString(s, " ")
+	if i := strings.Index(s, ","); i >= 0 {
+		notes = append(notes, strings.TrimSpace(s[i+1:]))
+		s = s[:i]
+	}
+	s = gluedUnit.ReplaceAllString(s, "$1 $2")
+	if m := preparationTail.FindStringSubmatch(strings.ToLower(s)); m != nil {
+		notes = append(notes, m[1])
+		s = s[:len(s)-len(m[0])]
+	}
+	words := strings.Fields(s)
+
+	for len(words) > 0 && approximately[strings.ToLower(words[0])] {
+		words = words[1:]
+		problem(0.05, "approximate")
+	}
+
+	// the amount, which can be a range
+	var amount float64
+	if len(words) > 0 {
+		var n int
+		amount, n = readAmount(words)
+		words = words[n:]
+		if n > 0 && len(words) > 1 && (words[0] == "-" || words[0] == "to" || words[0] == "or") {
+			if high, m := readAmount(words[1:]); m > 0 && high > amount {
+				l.Min, l.Max = amount, high
+				amount = (amount + high) / 2
+				words = words[1+m:]
+				problem(0.1, "a range, so it is the middle")
+			}
+		}
+	}
+	if len(words) > 0 && (words[0] == "x" || words[0] == "×") {
+		words = words[1:]
+	}
+
+	// the unit, which can be two words
+	u := unit{measure: "whole", factor: 1}
+	unitName := ""
+	if len(words) > 1 {
+		if found, ok := units[strings.ToLower(words[0]+" "+words[1])]; ok {
+			u, unitName, words = found, words[0]+" "+words[1], words[2:]
+		}
+	}
+	if unitName == "" && len(words) > 0 {
+		word := strings.TrimSuffix(words[0], ".")
+		found, ok := units[word]
+		if !ok && word != "T" && word != "t" {
+			found, ok = units[strings.ToLower(word)]
+		}
+		if ok {
+			u, unitName, words = found, word, words[1:]
+		}
+	}
+	if len(words) > 0 && strings.ToLower(words[0]) == "of" {
+		words = words[1:]
+	}
+
+	l.Element.Name = strings.Trim(strings.ToLower(strings.Join(words, " ")), " .;:")
+	l.Preparation = strings.Join(notes, ", ")
+	switch {
+	case amount == 0:
+		problem(0.7, "no amount")
+	case u.grams > 0:
+		l.Element.Grams = amount * u.grams
+		problem(0.5, "measured by weight, which has to be converted to a volume or to whole")
+	default:
+		l.Element.Amount = amount * u.factor
+		l.Element.Measure = u.measure
+		l.Min *= u.factor
+		l.Max *= u.factor
+	}
+	if u.counted {
+		problem(0.6, "counted in "+strings.ToLower(unitName)+", not whole")
+	}
+	if l.Element.Measure == "whole" {
+		l.Element.Name = singular(l.Element.Name)
+	}
+	switch words := strings.Fields(l.Element.Name); {
+	case len(words) == 0:
+		l.Confidence = 0
+		l.Problems = append(l.Problems, "no ingredient")
+	case len(words) > 4:
+		problem(0.2, "a long name")
+	}
+	if strings.IndexAny(l.Element.Name, "0123456789") >= 0 {
+		problem(0.2, "numbers in the name")
+	}
+	return
+}
+
+// singular returns the singular of the last word of a name, for things
+// that are counted, like "eggs"
+func singular(name string) string {
+	switch {
+	case strings.HasSuffix(name, "ies") && len(name) > 4:
+		return name[:len(name)-3] + "y"
+	case strings.HasSuffix(name, "oes"), strings.HasSuffix(name, "ches"), strings.HasSuffix(name, "shes"):
+		return name[:len(name)-2]
+	case strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") && !strings.HasSuffix(name, "us") && len(name) > 3:
+		return name[:len(name)-1]
+	}
+	return name
+}
@@ -0,0 +1,98 @@
+package ingredient
+
+import (
+	"testing"
+
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		text        string
+		element     recipe.Element
+		preparation string
+		ok          bool
+	}{
+		{"1 1/2 cups all-purpose flour, sifted", recipe.Element{Name: "all-purpose flour", Amount: 1.5, Measure: "cup"}, "sifted", true},
+		{"1 ⅜ cups sugar", recipe.Element{Name: "sugar", Amount: 1.375, Measure: "cup"}, "", true},
+		{"1½ Tbsp. milk (cold)", recipe.Element{Name: "milk", Amount: 1.5, Measure: "tablespoon"}, "cold", true},
+		{"⅛ tsp salt", recipe.Element{Name: "salt", Amount: 0.125, Measure: "teaspoon"}, "", true},
+		{"1 T butter", recipe.Element{Name: "butter", Amount: 1, Measure: "tablespoon"}, "", true},
+		{"1 t vanilla", recipe.Element{Name: "vanilla", Amount: 1, Measure: "teaspoon"}, "", true},
+		{"3 large eggs, beaten", recipe.Element{Name: "large egg", Amount: 3, Measure: "whole"}, "beaten", true},
+		{"2 cherries", recipe.Element{Name: "cherry", Amount: 2, Measure: "whole"}, "", true},
+		{"2 tomatoes", recipe.Element{Name: "tomato", Amount: 2, Measure: "whole"}, "", true},
+		{"about 2 cups of water", recipe.Element{Name: "water", Amount: 2, Measure: "cup"}, "", true},
+		{"1 stick butter, softened", recipe.Element{Name: "butter", Amount: 0.5, Measure: "cup"}, "softened", true},
+		{"473 ml milk", recipe.Element{Name: "milk", Amount: 473 / 236.5882365, Measure: "cup"}, "", true},
+		{"1 pinch salt", recipe.Element{Name: "salt", Amount: 1.0 / 16, Measure: "teaspoon"}, "", true},
+		{"salt to taste", recipe.Element{Name: "salt"}, "to taste", false},
+		{"8 ounces cream cheese", recipe.Element{Name: "cream cheese", Grams: 8 * 28.349523125}, "", false},
+		{"200g flour", recipe.Element{Name: "flour", Grams: 200}, "", false},
+		{"2 cloves garlic, minced", recipe.Element{Name: "garlic", Amount: 2, Measure: "whole"}, "minced", false},
+		{"2 cups", recipe.Element{Amount: 2, Measure: "cup"}, "", false},
+	} {
+		l := Parse(test.text)
+		assert.Equal(t, test.element.Name, l.Element.Name, test.text)
+		assert.InDelta(t, test.element.Amount, l.Element.Amount, 0.0001, test.text)
+		assert.Equal(t, test.element.Measure, l.Element.Measure, test.text)
+		assert.InDelta(t, test.element.Grams, l.Element.Grams, 0.0001, test.text)
+		assert.Equal(t, test.preparation, l.Preparation, test.text)
+		assert.Equal(t, test.ok, l.OK(), test.text)
+		assert.Equal(t, test.text, l.Text)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	for _, text := range []string{"2-3 cups milk", "2 to 3 cups milk", "2 – 3 cups milk", "2 or 3 cups milk"} {
+		l := Parse(text)
+		assert.Equal(t, "milk", l.Element.Name, text)
+		assert.Equal(t, 2.5, l.Element.Amount, text)
+		assert.Equal(t, 2.0, l.Min, text)
+		assert.Equal(t, 3.0, l.Max, text)
+		assert.Equal(t, 0.9, l.Confidence, text)
+		assert.True(t, l.OK(), text)
+	}
+	l := Parse("½-1 tablespoon honey")
+	assert.Equal(t, 0.75, l.Element.Amount)
+	assert.Equal(t, "honey", l.Element.Name)
+}
+
+func TestConfidence(t *testing.T) {
+	assert.Equal(t, 1.0, Parse("1 cup flour").Confidence)
+	assert.Equal(t, []string{}, Parse("1 cup flour").Problems)
+	assert.Equal(t, 0.3, Parse("salt to taste").Confidence)
+	assert.Equal(t, []string{"no amount"}, Parse("salt to taste").Problems)
+	assert.Equal(t, 0.0, Parse("2 cups").Confidence)
+	assert.True(t, Parse("1 cup of flour mixed with a little bit of sugar").Confidence < 1)
+}
+
+func TestFormatted(t *testing.T) {
+	// whatever the recipes write can be read back
+	for _, amount := range []float64{0.125, 0.25, 0.5, 0.75, 1, 1.375, 2.5, 21.125} {
+		text := recipe.FormatMeasure(amount, "cup") + " flour"
+		l := Parse(text)
+		assert.True(t, l.OK(), text)
+		cupsPer := map[string]float64{"cup": 1, "tablespoon": 1.0 / 16, "teaspoon": 1.0 / 48}
+		assert.InDelta(t, amount, l.Element.Amount*cupsPer[l.Element.Measure], 0.0001, text)
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for s, amount := range map[string]float64{"2": 2, "0.5": 0.5, "1/2": 0.5, "1 1/2": 1.5, "1 ½": 1.5, "1½": 1.5, "¾": 0.75} {
+		a, ok := ParseAmount(s)
+		assert.True(t, ok, s)
+		assert.Equal(t, amount, a, s)
+	}
+	for _, s := range []string{"", "a", "1 cup", "1/0"} {
+		_, ok := ParseAmount(s)
+		assert.False(t, ok, s)
+	}
+	measure, factor, ok := ParseUnit("Tbsp.")
+	assert.True(t, ok)
+	assert.Equal(t, "tablespoon", measure)
+	assert.Equal(t, 1.0, factor)
+	_, _, ok = ParseUnit("grams")
+	assert.False(t, ok)
+}
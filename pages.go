@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/schollz/recursive-recipes/schema"
+	"github.com/schollz/recursive-recipes/store"
+)
+
+const siteURL = "https://recursive.recipes"
+
+// plans are the saved requests, see -plans
+var plans *store.Store
+
+// metadataTemplate is the metadata of the pages, which is loaded with the
+// other templates when the server starts
+var metadataTemplate *template.Template
+
+// genericMetadata matches the metadata of the app that is replaced for
+// each recipe
+var genericMetadata = regexp.MustCompile(`<title>[^<]*</title>|<meta (name|itemprop)="(description|image|name|twitter:title|twitter:description|twitter:image:src|og:title|og:description|og:image|og:url|og:type)" content="[^"]*">`)
+
+type metadata struct {
+	Title       string
+	Description string
+	Image       string
+	URL         string
+	Request     *recipe.RequestFromApp
+
+	// Recipe is the schema.org Recipe of the page, for search engines
+	Recipe *schema.Recipe
+}
+
+// renderApp serves the app with the metadata of the recipe, and the saved
+// request for the app to restore, if there is one
+func renderApp(c *gin.Context, m metadata) {
+	page, err := ioutil.ReadFile("./scratch/app/build/index.html")
+	if err != nil {
+		log.Println(err)
+		c.String(http.StatusInternalServerError, "no app")
+		return
+	}
+	var rendered bytes.Buffer
+	if err = metadataTemplate.Execute(&rendered, m); err != nil {
+		log.Println(err)
+		c.String(http.StatusInternalServerError, "no app")
+		return
+	}
+	page = genericMetadata.ReplaceAll(page, []byte{})
+	page = bytes.Replace(page, []byte("</head>"), append(rendered.Bytes(), []byte("</head>")...), 1)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page)
+}
+
+func recipeMetadata(info recipe.RecipeInfo) (m metadata) {
+	m = metadata{
+		Title:       info.Title + " | Recursive Recipes",
+		Description: info.Description,
+		Image:       siteURL + "/static/favicon/apple-icon-180x180.png",
+		URL:         siteURL + "/recipe/" + slugify(info.Name),
+	}
+	if m.Description == "" {
+		m.Description = "Make " + info.Name + " from scratch, following each ingredient back to where it comes from."
+	}
+	if info.Image != "" {
+		m.Image = info.Image
+		if strings.HasPrefix(m.Image, "/") {
+			m.Image = siteURL + m.Image
+		}
+	}
+	return
+}
+
+// schemas are the schema.org Recipes of the pages of the recipes, which are
+// planned again only when the catalog changes
+var schemas struct {
+	sync.Mutex
+	version int
+	recipes map[string]*schema.Recipe
+}
+
+// recipeSchema is the schema.org Recipe of the page of a recipe, which
+// makes the recipe itself and buys everything in it
+func recipeSchema(ctx context.Context, info recipe.RecipeInfo, m metadata) *schema.Recipe {
+	version, err := recipe.CatalogVersion()
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	schemas.Lock()
+	if schemas.recipes == nil || schemas.version != version {
+		schemas.version = version
+		schemas.recipes = make(map[string]*schema.Recipe)
+	}
+	r, ok := schemas.recipes[info.Name]
+	schemas.Unlock()
+	if ok {
+		return r
+	}
+
+	plan, err := recipe.GetPlanContext(ctx, recipe.RequestFromApp{
+		Recipe:             info.Name,
+		IngredientsToBuild: map[string]struct{}{info.Name: {}},
+		NoGraph:            true,
+	})
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	s := schema.New(info, plan)
+	s.Image = m.Image
+	s.URL = m.URL
+	r = &s
+
+	schemas.Lock()
+	if schemas.version == version {
+		schemas.recipes[info.Name] = r
+	}
+	schemas.Unlock()
+	return r
+}
+
+// apiSavePlanHandler saves the request in the body and returns its id
+func apiSavePlanHandler(c *gin.Context) {
+	var clientPayload recipe.RequestFromApp
+	if err := c.ShouldBindJSON(&clientPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	if _, err := recipe.PublishedRecipe(clientPayload.Recipe); errors.Is(err, recipe.ErrUnknownRecipe) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such recipe " + clientPayload.Recipe, "code": "unknown_recipe"})
+		return
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load recipes", "code": "catalog_error"})
+		return
+	}
+	value, _ := json.Marshal(clientPayload)
+	id, err := plans.Put(value)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save plan", "code": "store_error"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"id": id, "url": "/p/" + id})
+}
+
+// getSavedPlan returns the saved request with the id
+func getSavedPlan(id string) (clientPayload recipe.RequestFromApp, err error) {
+	value, err := plans.Get(id)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(value, &clientPayload)
+	return
+}
+
+func apiGetPlanHandler(c *gin.Context) {
+	clientPayload, err := getSavedPlan(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such plan", "code": "unknown_plan"})
+		return
+	}
+	c.JSON(http.StatusOK, clientPayload)
+}
+
+// permalinkHandler serves the app for a saved plan, with the metadata of
+// that exact plan
+func permalinkHandler(c *gin.Context) {
+	id := c.Param("id")
+	clientPayload, err := getSavedPlan(id)
+	if err != nil {
+		renderIndex(c)
+		return
+	}
+	info, err := recipe.PublishedRecipe(clientPayload.Recipe)
+	if err != nil {
+		info = recipe.RecipeInfo{Name: clientPayload.Recipe, Title: strings.Title(clientPayload.Recipe)}
+	}
+	m := recipeMetadata(info)
+	m.URL = siteURL + "/p/" + id
+	m.Request = &clientPayload
+
+	// the description only needs the plan itself, which the app computes
+	// in full
+	preview := prepareRequest(clientPayload)
+	preview.NoGraph = true
+	preview.Samples = 0
+	preview.Sensitivity = false
+	plan, err := recipe.GetPlanContext(c.Request.Context(), preview)
+	if err == nil {
+		payload := plan.UpdateApp()
+		m.Description = fmt.Sprintf("Make %s of %s from scratch in %s, with $%2.2f of ingredients.",
+			recipe.FormatMeasure(payload.Amount, payload.Measure), plan.Recipe, strings.ToLower(payload.TotalTime), float64(plan.CostCents)/100)
+	}
+	renderApp(c, m)
+}
@@ -0,0 +1,108 @@
+package recipe
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Season is when a reaction, like planting a crop, can start.
+type Season struct {
+	// Months are the months (1 to 12) in the northern hemisphere in which
+	// the reaction can start
+	Months []int `toml:"months" json:"months,omitempty"`
+
+	// HarvestLag is the hours after the reaction finishes before its
+	// products are harvested and can be used, e.g. for curing or waiting
+	// for the harvest season
+	HarvestLag float64 `toml:"harvest_lag" json:"harvest_lag,omitempty"`
+}
+
+const dateFormat = "2006-01-02"
+
+// window is when something in the plan is made
+type window struct {
+	start time.Time
+	ready time.Time
+}
+
+func hoursToDuration(hours float64) time.Duration {
+	return time.Duration(hours * float64(time.Hour))
+}
+
+// parseStart returns the start date and whether the plan is in the southern
+// hemisphere, which defaults to the northern hemisphere. Without a start
+// date the time is zero.
+func parseStart(start string, hemisphere string) (t time.Time, south bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(hemisphere)) {
+	case "", "north", "northern":
+	case "south", "southern":
+		south = true
+	default:
+		err = errors.New("unknown hemisphere " + hemisphere)
+		return
+	}
+	if start == "" {
+		return
+	}
+	t, err = time.Parse(dateFormat, start)
+	if err != nil {
+		err = errors.New("start date must be YYYY-MM-DD")
+	}
+	return
+}
+
+// nextSeason returns the first time, from t onwards, that is in one of the
+// months. Seasons in the southern hemisphere are six months apart.
+func nextSeason(t time.Time, months []int, south bool) time.Time {
+	if len(months) == 0 {
+		return t
+	}
+	allowed := make(map[int]struct{})
+	for _, month := range months {
+		if south {
+			month = (month+5)%12 + 1
+		}
+		allowed[month] = struct{}{}
+	}
+	for i := 0; i < 12; i++ {
+		if _, ok := allowed[int(t.Month())]; ok {
+			return t
+		}
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+// scheduleDag determines when everything that is made in the (pruned)
+// tree starts and is ready, where everything waits for what it is made
+// from and for its season. Bought things are ready at the start.
+func scheduleDag(d *Dag, start time.Time, south bool, reactions map[string]Reaction, schedule map[string]window) (ready time.Time) {
+	if len(d.Children) == 0 {
+		return start
+	}
+	begin := start
+	for _, child := range d.Children {
+		childReady := scheduleDag(child, start, south, reactions, schedule)
+		if childReady.After(begin) {
+			begin = childReady
+		}
+	}
+	harvestLag := 0.0
+	if season := reactions[d.Product.Name].Season; season != nil {
+		begin = nextSeason(begin, season.Months, south)
+		harvestLag = season.HarvestLag
+	}
+	ready = begin.Add(hoursToDuration(d.SerialHours + d.ParallelHours + harvestLag))
+
+	// the same thing may be made in several places, so keep its whole span
+	w, ok := schedule[d.Product.Name]
+	if !ok || begin.Before(w.start) {
+		w.start = begin
+	}
+	if ready.After(w.ready) {
+		w.ready = ready
+	}
+	schedule[d.Product.Name] = w
+	return
+}
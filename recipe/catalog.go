@@ -0,0 +1,373 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// CatalogFile is the catalog of reactions, which is a toml file or a
+// directory of them (e.g. one per recipe or per category)
+var CatalogFile = "recipes.toml"
+
+// RecipeInfo describes a published recipe
+type RecipeInfo struct {
+	Name        string `json:"name"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	Category    string `json:"category,omitempty"`
+	Featured    bool   `json:"featured"`
+}
+
+// catalog is what is derived from the catalog the last time it changed
+var catalog struct {
+	sync.Mutex
+	// version counts the times the catalog changed
+	version int
+	fname   string
+	sources map[string]time.Time
+	recipes []RecipeInfo
+	index   *searchIndex
+}
+
+// reloadCatalog rebuilds the published recipes and the search index
+// whenever a file of the catalog changes. It must be called with the lock
+// held.
+func reloadCatalog() (err error) {
+	if catalog.recipes != nil && catalog.fname == CatalogFile && !changed(catalog.sources) {
+		return
+	}
+	r, sources, err := loadCatalog(CatalogFile)
+	if err != nil {
+		return
+	}
+	recipes := publishedRecipes(r)
+	catalog.version++
+	catalog.fname = CatalogFile
+	catalog.sources = sources
+	catalog.recipes = recipes
+	catalog.index = newSearchIndex(indexReactions(r), recipes)
+	return
+}
+
+// changed is whether any of the files or directories have changed since
+// they were read
+func changed(sources map[string]time.Time) bool {
+	for fname, modTime := range sources {
+		info, err := os.Stat(fname)
+		if err != nil || !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conflict is a product that more than one file of a catalog makes
+type Conflict struct {
+	Product string
+	Files   []string
+}
+
+// ConflictError is returned when files of the same catalog make the same
+// products. Alternative reactions for a product go in the same file.
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	conflicts := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		conflicts[i] = fmt.Sprintf("%s is made in %s", c.Product, strings.Join(c.Files, " and "))
+	}
+	return "conflicting reactions: " + strings.Join(conflicts, "; ")
+}
+
+// catalogFile is a file of a catalog, which can include other catalogs
+type catalogFile struct {
+	Include       []string       `toml:"include"`
+	Reactions     []Reaction     `toml:"reaction"`
+	Substitutions []Substitution `toml:"substitution"`
+}
+
+// LoadCatalog returns the reactions and substitutions of the catalog, in
+// the order they are in. The catalog can be a toml file or a directory of
+// them, and it can include other catalogs with
+//
+//	include = ["../recursive-recipes/recipes"]
+//
+// (relative to the file), e.g. to keep private recipes over the public
+// ones. The reactions of the catalog override the ones of the catalogs it
+// includes for the same products, and later includes override earlier ones.
+func LoadCatalog(fname string) (r Reactions, err error) {
+	r, _, err = loadCatalog(fname)
+	return
+}
+
+// ErrCatalog is the error of a catalog that can't be loaded, which wraps
+// why (e.g. a *ConflictError)
+var ErrCatalog = errors.New("catalog can't be loaded")
+
+// catalogError is why a catalog can't be loaded, which is an ErrCatalog
+type catalogError struct {
+	err error
+}
+
+func (e catalogError) Error() string {
+	return e.err.Error()
+}
+
+func (e catalogError) Unwrap() error {
+	return e.err
+}
+
+func (e catalogError) Is(target error) bool {
+	return target == ErrCatalog
+}
+
+// loadCatalog loads the catalog and returns when each of its files and
+// directories was last modified, to tell when it changes
+func loadCatalog(fname string) (r Reactions, sources map[string]time.Time, err error) {
+	l := catalogLoader{sources: make(map[string]time.Time), loading: make(map[string]bool)}
+	r, err = l.load(fname)
+	if err != nil {
+		err = catalogError{err}
+	}
+	sources = l.sources
+	return
+}
+
+type catalogLoader struct {
+	sources map[string]time.Time
+	// loading are the catalogs being loaded, to stop include cycles
+	loading map[string]bool
+}
+
+func (l *catalogLoader) load(fname string) (r Reactions, err error) {
+	abs, err := filepath.Abs(fname)
+	if err != nil {
+		return
+	}
+	if l.loading[abs] {
+		err = fmt.Errorf("%s includes itself", fname)
+		return
+	}
+	l.loading[abs] = true
+	defer delete(l.loading, abs)
+
+	files, err := l.files(fname)
+	if err != nil {
+		return
+	}
+	var own Reactions
+	includes := []string{}
+	madeIn := make(map[string][]string)
+	products := []string{}
+	for _, file := range files {
+		var f catalogFile
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return r, err
+		}
+		if _, err = toml.Decode(string(b), &f); err != nil {
+			return r, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, include := range f.Include {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(file), include)
+			}
+			includes = append(includes, include)
+		}
+		for _, reaction := range f.Reactions {
+			for _, product := range reaction.Product {
+				in := madeIn[product.Name]
+				if len(in) == 0 {
+					products = append(products, product.Name)
+				}
+				if len(in) == 0 || in[len(in)-1] != file {
+					madeIn[product.Name] = append(in, file)
+				}
+			}
+		}
+		own.Reactions = append(own.Reactions, f.Reactions...)
+		own.Substitutions = append(own.Substitutions, f.Substitutions...)
+	}
+	conflicts := []Conflict{}
+	for _, product := range products {
+		if len(madeIn[product]) > 1 {
+			conflicts = append(conflicts, Conflict{Product: product, Files: madeIn[product]})
+		}
+	}
+	if len(conflicts) > 0 {
+		err = &ConflictError{Conflicts: conflicts}
+		return
+	}
+
+	for _, include := range includes {
+		included, err := l.load(include)
+		if err != nil {
+			return r, fmt.Errorf("%s: %w", fname, err)
+		}
+		r = override(r, included)
+	}
+	r = override(r, own)
+	return
+}
+
+// files returns the toml files of the catalog, which are all the files in
+// the directory (except hidden ones) if it is a directory
+func (l *catalogLoader) files(fname string) (files []string, err error) {
+	info, err := os.Stat(fname)
+	if err != nil {
+		return
+	}
+	l.sources[fname] = info.ModTime()
+	if !info.IsDir() {
+		return []string{fname}, nil
+	}
+	err = filepath.Walk(fname, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		hidden := path != fname && strings.HasPrefix(info.Name(), ".")
+		switch {
+		case info.IsDir() && hidden:
+			return filepath.SkipDir
+		case info.IsDir():
+			l.sources[path] = info.ModTime()
+		case !hidden && filepath.Ext(path) == ".toml":
+			l.sources[path] = info.ModTime()
+			files = append(files, path)
+		}
+		return nil
+	})
+	return
+}
+
+// override returns the reactions and substitutions of the top catalog
+// over the ones of the base. A reaction of the base keeps the products
+// that the top doesn't make, and the substitutions of the top replace the
+// ones of the base for the same ingredients.
+func override(base, top Reactions) (r Reactions) {
+	made := make(map[string]bool)
+	for _, reaction := range top.Reactions {
+		for _, product := range reaction.Product {
+			made[product.Name] = true
+		}
+	}
+	substituted := make(map[string]bool)
+	for _, s := range top.Substitutions {
+		substituted[s.From.Name] = true
+	}
+
+	for _, reaction := range base.Reactions {
+		products := []Element{}
+		for _, product := range reaction.Product {
+			if !made[product.Name] {
+				products = append(products, product)
+			}
+		}
+		if len(products) == 0 && len(reaction.Product) > 0 {
+			continue
+		}
+		reaction.Product = products
+		r.Reactions = append(r.Reactions, reaction)
+	}
+	r.Reactions = append(r.Reactions, top.Reactions...)
+	for _, s := range base.Substitutions {
+		if !substituted[s.From.Name] {
+			r.Substitutions = append(r.Substitutions, s)
+		}
+	}
+	r.Substitutions = append(r.Substitutions, top.Substitutions...)
+	return
+}
+
+// Recipes returns the published recipes of the catalog, the featured ones
+// first, reloading them whenever the catalog changes.
+func Recipes() (recipes []RecipeInfo, err error) {
+	catalog.Lock()
+	defer catalog.Unlock()
+	if err = reloadCatalog(); err != nil {
+		return
+	}
+	recipes = catalog.recipes
+	return
+}
+
+// CatalogVersion returns a number that changes whenever the catalog changes,
+// for what is derived from the catalog to be kept until then
+func CatalogVersion() (version int, err error) {
+	catalog.Lock()
+	defer catalog.Unlock()
+	if err = reloadCatalog(); err != nil {
+		return
+	}
+	version = catalog.version
+	return
+}
+
+// PublishedRecipe returns the published recipe with the name
+func PublishedRecipe(name string) (recipe RecipeInfo, err error) {
+	recipes, err := Recipes()
+	if err != nil {
+		return
+	}
+	for _, recipe = range recipes {
+		if recipe.Name == name {
+			return
+		}
+	}
+	err = fmt.Errorf("%w: %s", ErrUnknownRecipe, name)
+	return
+}
+
+// loadRecipes returns the published recipes in the order of the catalog,
+// with the featured ones first
+func loadRecipes(fname string) (recipes []RecipeInfo, err error) {
+	r, err := LoadCatalog(fname)
+	if err != nil {
+		return
+	}
+	recipes = publishedRecipes(r)
+	return
+}
+
+func publishedRecipes(r Reactions) (recipes []RecipeInfo) {
+	recipes = []RecipeInfo{}
+	have := make(map[string]struct{})
+	for _, reaction := range r.Reactions {
+		if !reaction.Published || len(reaction.Product) == 0 {
+			continue
+		}
+		name := reaction.Product[0].Name
+		if _, ok := have[name]; ok {
+			continue
+		}
+		have[name] = struct{}{}
+		recipe := RecipeInfo{
+			Name:        name,
+			Title:       reaction.Title,
+			Description: reaction.Description,
+			Image:       reaction.Image,
+			Category:    reaction.Category,
+			Featured:    reaction.Featured,
+		}
+		if recipe.Title == "" {
+			recipe.Title = strings.Title(name)
+		}
+		recipes = append(recipes, recipe)
+	}
+	sort.SliceStable(recipes, func(i, j int) bool {
+		return recipes[i].Featured && !recipes[j].Featured
+	})
+	return
+}
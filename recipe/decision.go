@@ -0,0 +1,103 @@
+package recipe
+
+import (
+	"fmt"
+)
+
+// Reasons that an ingredient is made or bought
+const (
+	ReasonRequested    = "requested"
+	ReasonWithinTime   = "within time"
+	ReasonExceededTime = "exceeded time"
+	ReasonNoReaction   = "no reaction"
+	ReasonExcluded     = "excluded"
+	ReasonCheaper      = "cheaper to buy"
+)
+
+// pruneTreeByCost buys everything (but the recipe itself) that costs more
+// to make from its reactants than to buy, unless it has to be made.
+func pruneTreeByCost(d *Dag, reactions map[string]Reaction, ingredientsToMake map[string]struct{}, depth int) {
+	if len(d.Children) == 0 {
+		return
+	}
+	if _, ok := ingredientsToMake[d.Product.Name]; !ok && depth > 0 && cheaperToBuy(reactions, d.Product) {
+		d.Children = []*Dag{}
+		d.SerialHours = 0
+		d.ParallelHours = 0
+		d.Reason = ReasonCheaper
+		return
+	}
+	for _, child := range d.Children {
+		pruneTreeByCost(child, reactions, ingredientsToMake, depth+1)
+	}
+}
+
+// explainDag sets the reason that each node of the (pruned) tree is made
+// or bought. Ingredients that pruneTreeByCost bought stay cheaper to buy
+// (unless they couldn't be made anyway), and the others that could be made
+// exceeded the time.
+func explainDag(d *Dag, depth int, reactions map[string]Reaction, requested map[string]struct{}, mustMake map[string]struct{}, unavailable map[string]struct{}) {
+	d.Depth = depth
+	name := d.Product.Name
+	_, isRequested := requested[name]
+	_, isMustMake := mustMake[name]
+	_, isUnavailable := unavailable[name]
+	reaction, hasReaction := reactions[name]
+	if len(d.Children) > 0 {
+		switch {
+		case isMustMake:
+			d.Reason = ReasonExcluded
+			d.Why = "made because buying it is excluded by the diet"
+		case isUnavailable:
+			d.Reason = ReasonExcluded
+			d.Why = "made because it is unavailable to buy"
+		case isRequested:
+			d.Reason = ReasonRequested
+			d.Why = "made because it was requested"
+		default:
+			d.Reason = ReasonWithinTime
+			d.Why = "made because there is time to make it"
+		}
+		for _, child := range d.Children {
+			explainDag(child, depth+1, reactions, requested, mustMake, unavailable)
+		}
+		return
+	}
+
+	switch {
+	case hasReaction && reaction.excluded:
+		d.Reason = ReasonExcluded
+		d.Why = "bought because making it is excluded by the diet"
+	case !hasReaction || len(reaction.Reactant) == 0:
+		d.Reason = ReasonNoReaction
+		d.Why = "bought because there is no reaction to make it"
+	case d.Reason == ReasonCheaper:
+		d.Why = "bought because it is cheaper to buy than to make"
+	default:
+		d.Reason = ReasonExceededTime
+		d.Why = fmt.Sprintf("bought because making it exceeds the time budget at depth %d", depth)
+		if cheaperToBuy(reactions, d.Product) {
+			d.Why += " (it is also cheaper to buy)"
+		}
+	}
+}
+
+// cheaperToBuy is whether buying the product costs less than buying its
+// reactants to make it
+func cheaperToBuy(reactions map[string]Reaction, product Element) bool {
+	priceDifference, _, err := scratchReplacement(reactions, product.Name, product.Amount)
+	return err == nil && priceDifference > 0
+}
+
+// shallowestNodes returns the node of each ingredient that is closest to
+// the recipe, which is the one that explains the ingredient.
+func shallowestNodes(d *Dag) (nodes map[string]*Dag) {
+	nodes = make(map[string]*Dag)
+	for _, node := range getDagRoots(d, []*Dag{}) {
+		if other, ok := nodes[node.Product.Name]; ok && other.Depth <= node.Depth {
+			continue
+		}
+		nodes[node.Product.Name] = node
+	}
+	return
+}
@@ -0,0 +1,199 @@
+package recipe
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// impliedTags are tags that come along with another tag
+var impliedTags = map[string][]string{
+	"dairy": {"animal-derived"},
+	"egg":   {"animal-derived"},
+	"pork":  {"animal-derived"},
+}
+
+// diets are the tags that each diet excludes
+var diets = map[string][]string{
+	"vegan":       {"animal-derived"},
+	"gluten-free": {"gluten"},
+	"dairy-free":  {"dairy"},
+	"egg-free":    {"egg"},
+	"nut-free":    {"nut"},
+}
+
+// excludedTags returns the tags that can't be in a recipe for the diets
+func excludedTags(dietNames []string) (excluded map[string]struct{}, err error) {
+	excluded = make(map[string]struct{})
+	for _, dietName := range dietNames {
+		dietName = strings.ToLower(strings.TrimSpace(dietName))
+		if dietName == "" {
+			continue
+		}
+		tags, ok := diets[dietName]
+		if !ok {
+			err = errors.New("unknown diet " + dietName)
+			return
+		}
+		for _, tag := range tags {
+			excluded[tag] = struct{}{}
+		}
+	}
+	return
+}
+
+func addTag(tags map[string]struct{}, tag string) {
+	tags[tag] = struct{}{}
+	for _, implied := range impliedTags[tag] {
+		addTag(tags, implied)
+	}
+}
+
+// declaredTags returns the tags of the product no matter how it is made
+func declaredTags(reactions map[string]Reaction, name string) (tags map[string]struct{}) {
+	tags = make(map[string]struct{})
+	if reaction, ok := reactions[name]; ok {
+		for _, tag := range reaction.Product[0].Tags {
+			addTag(tags, tag)
+		}
+	}
+	return
+}
+
+// productTags returns the tags of buying the product, which are either the
+// tags of the product or the tags of the reactants that make it.
+func productTags(reactions map[string]Reaction, name string, depth int) (tags map[string]struct{}) {
+	tags = declaredTags(reactions, name)
+	reaction, ok := reactions[name]
+	if !ok || depth > 20 || reaction.Product[0].Tags != nil {
+		return
+	}
+	for _, reactant := range reaction.Reactant {
+		for tag := range productTags(reactions, reactant.Name, depth+1) {
+			tags[tag] = struct{}{}
+		}
+	}
+	return
+}
+
+// planTags returns the tags of the plan, where everything that is bought
+// has the tags of its product and everything that is made has its own tags
+// and the tags of what it is made from.
+func planTags(d *Dag, reactions map[string]Reaction) (tags map[string]struct{}) {
+	if len(d.Children) == 0 {
+		return productTags(reactions, d.Product.Name, 0)
+	}
+	tags = declaredTags(reactions, d.Product.Name)
+	for _, child := range d.Children {
+		for tag := range planTags(child, reactions) {
+			tags[tag] = struct{}{}
+		}
+	}
+	return
+}
+
+func sortedTags(tags map[string]struct{}) (s []string) {
+	s = []string{}
+	for tag := range tags {
+		s = append(s, tag)
+	}
+	sort.Strings(s)
+	return
+}
+
+func forbiddenTag(tags map[string]struct{}, excluded map[string]struct{}) string {
+	for _, tag := range sortedTags(tags) {
+		if _, ok := excluded[tag]; ok {
+			return tag
+		}
+	}
+	return ""
+}
+
+// applyDiet chooses, for everything the recipe could need, a reaction that
+// doesn't use anything with an excluded tag. Things that can't be bought
+// because of their tags have to be made, and things that can only be made
+// with excluded tags have to be bought. If the recipe can't be made or
+// bought at all, the error explains why.
+func applyDiet(reactions map[string]Reaction, recipe string, excluded map[string]struct{}) (compliant map[string]Reaction, mustMake map[string]struct{}, err error) {
+	compliant = make(map[string]Reaction)
+	for name, reaction := range reactions {
+		compliant[name] = reaction
+	}
+	mustMake = make(map[string]struct{})
+	if len(excluded) == 0 {
+		return
+	}
+
+	results := make(map[string]string)
+	visiting := make(map[string]struct{})
+	var satisfy func(name string) (reason string)
+	satisfy = func(name string) (reason string) {
+		if result, ok := results[name]; ok {
+			return result
+		}
+		if _, ok := visiting[name]; ok {
+			return name + " is made from itself"
+		}
+		visiting[name] = struct{}{}
+		defer delete(visiting, name)
+
+		tags := productTags(reactions, name, 0)
+		tagToAvoid := forbiddenTag(tags, excluded)
+		reaction, ok := reactions[name]
+		if !ok || forbiddenTag(declaredTags(reactions, name), excluded) != "" {
+			// there is no way around it
+			if tagToAvoid != "" {
+				reason = fmt.Sprintf("%s contains %s", name, tagToAvoid)
+			}
+			results[name] = reason
+			return
+		}
+
+		reasons := []string{}
+		for _, candidate := range append([]Reaction{reaction}, reaction.alternatives...) {
+			if len(candidate.Reactant) == 0 {
+				continue
+			}
+			candidateReason := ""
+			for _, reactant := range candidate.Reactant {
+				candidateReason = satisfy(reactant.Name)
+				if candidateReason != "" {
+					break
+				}
+			}
+			if candidateReason == "" {
+				candidate.Product = reaction.Product
+				candidate.alternatives = nil
+				compliant[name] = candidate
+				if tagToAvoid != "" {
+					mustMake[name] = struct{}{}
+				}
+				results[name] = ""
+				return
+			}
+			reasons = append(reasons, candidateReason)
+		}
+
+		if tagToAvoid == "" {
+			// can't be made, but can be bought, so it can only be bought
+			product := reaction.Product[0]
+			product.Tags = sortedTags(tags)
+			compliant[name] = Reaction{Product: []Element{product}, excluded: true}
+			results[name] = ""
+			return
+		}
+		reason = fmt.Sprintf("%s contains %s", name, tagToAvoid)
+		if len(reasons) > 0 {
+			reason += " and making it fails because " + strings.Join(reasons, ", or ")
+		}
+		results[name] = reason
+		return
+	}
+
+	if reason := satisfy(recipe); reason != "" {
+		err = errors.New("no compliant plan for " + recipe + ": " + reason)
+	}
+	return
+}
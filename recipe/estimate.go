@@ -0,0 +1,180 @@
+package recipe
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// MaxSamples limits how many times a plan is sampled, which the server
+// keeps lower for requests from anyone (see -max-samples)
+var MaxSamples = 100000
+
+// Percentiles summarize the samples of an estimate
+type Percentiles struct {
+	P10    float64 `json:"p10"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+}
+
+// PlanEstimate is the range of the total cost (in cents) and the total
+// time (in seconds) of the plan, from sampling the uncertain prices and
+// times.
+type PlanEstimate struct {
+	Samples   int         `json:"samples"`
+	Seed      int64       `json:"seed"`
+	CostCents Percentiles `json:"costCents"`
+	Seconds   Percentiles `json:"seconds"`
+}
+
+// UpdateAppEstimate is the range of the total cost (in dollars) and the
+// total time (in hours) of the plan, from sampling the uncertain prices
+// and times.
+type UpdateAppEstimate struct {
+	Samples int         `json:"samples"`
+	Seed    int64       `json:"seed"`
+	Cost    Percentiles `json:"cost"`
+	Hours   Percentiles `json:"hours"`
+}
+
+// triangular samples a triangular distribution, which only needs the
+// minimum, the most likely value and the maximum.
+func triangular(r *rand.Rand, min, mode, max float64) float64 {
+	if min > mode {
+		min = mode
+	}
+	if max < mode {
+		max = mode
+	}
+	if max == min {
+		return mode
+	}
+	u := r.Float64()
+	if u < (mode-min)/(max-min) {
+		return min + math.Sqrt(u*(max-min)*(mode-min))
+	}
+	return max - math.Sqrt((1-u)*(max-min)*(max-mode))
+}
+
+// sampleFactor samples the value, which may be a range, and returns it
+// relative to the point estimate.
+func sampleFactor(r *rand.Rand, min, mode, max float64) float64 {
+	if mode == 0 || (min == 0 && max == 0) {
+		return 1
+	}
+	if min == 0 {
+		min = mode
+	}
+	if max == 0 {
+		max = mode
+	}
+	return triangular(r, min, mode, max) / mode
+}
+
+// factors are the sampled values of a plan, relative to the point estimates
+type factors struct {
+	price       map[string]float64
+	serialHours map[string]float64
+	parallel    map[string]float64
+}
+
+// sampleFactors samples every price and time once, so that the same
+// ingredient has the same price everywhere in the plan.
+func sampleFactors(r *rand.Rand, reactions map[string]Reaction, names []string) (f factors) {
+	f = factors{
+		price:       make(map[string]float64),
+		serialHours: make(map[string]float64),
+		parallel:    make(map[string]float64),
+	}
+	for _, name := range names {
+		reaction := reactions[name]
+		product := reaction.Product[0]
+		f.price[name] = sampleFactor(r, product.PriceMin, product.Price, product.PriceMax)
+		f.serialHours[name] = sampleFactor(r, reaction.SerialHoursMin, reaction.SerialHours, reaction.SerialHoursMax)
+		f.parallel[name] = sampleFactor(r, reaction.ParallelHoursMin, reaction.ParallelHours, reaction.ParallelHoursMax)
+	}
+	return
+}
+
+// sampleDag returns the total cost and time of the (pruned) tree for the
+// sampled values. Without any samples, these are the point estimates.
+func sampleDag(d *Dag, f factors) (cost float64, hours float64) {
+	if len(d.Children) == 0 {
+		cost = d.Product.Price
+		if factor, ok := f.price[d.Product.Name]; ok {
+			cost *= factor
+		}
+		return
+	}
+	serialFactor, parallelFactor := 1.0, 1.0
+	if factor, ok := f.serialHours[d.Product.Name]; ok {
+		serialFactor = factor
+	}
+	if factor, ok := f.parallel[d.Product.Name]; ok {
+		parallelFactor = factor
+	}
+	hours = d.SerialHours*serialFactor + d.ParallelHours*parallelFactor
+	for _, child := range d.Children {
+		childCost, childHours := sampleDag(child, f)
+		cost += childCost
+		hours += childHours
+	}
+	return
+}
+
+// percentiles returns the percentiles of the values, rounded
+func percentiles(values []float64) (p Percentiles) {
+	sort.Float64s(values)
+	at := func(q float64) float64 {
+		i := q * float64(len(values)-1)
+		lower := math.Floor(i)
+		upper := math.Ceil(i)
+		v := values[int(lower)] + (values[int(upper)]-values[int(lower)])*(i-lower)
+		return math.Round(v)
+	}
+	p.P10 = at(0.1)
+	p.Median = at(0.5)
+	p.P90 = at(0.9)
+	return
+}
+
+// estimatePlan samples the uncertain prices and times of the (pruned) tree
+// and returns the range of the total cost and time. The same seed always
+// gives the same estimate.
+func estimatePlan(d *Dag, reactions map[string]Reaction, samples int, seed int64) (estimate *PlanEstimate) {
+	if samples <= 0 {
+		return
+	}
+	if samples > MaxSamples {
+		samples = MaxSamples
+	}
+	names := []string{}
+	have := make(map[string]struct{})
+	for _, node := range getDagRoots(d, []*Dag{}) {
+		if _, ok := have[node.Product.Name]; ok {
+			continue
+		}
+		if _, ok := reactions[node.Product.Name]; !ok {
+			continue
+		}
+		have[node.Product.Name] = struct{}{}
+		names = append(names, node.Product.Name)
+	}
+	sort.Strings(names)
+
+	r := rand.New(rand.NewSource(seed))
+	costs := make([]float64, samples)
+	seconds := make([]float64, samples)
+	for i := 0; i < samples; i++ {
+		cost, hours := sampleDag(d, sampleFactors(r, reactions, names))
+		costs[i] = cost * 100
+		seconds[i] = hours * 3600
+	}
+	estimate = &PlanEstimate{
+		Samples:   samples,
+		Seed:      seed,
+		CostCents: percentiles(costs),
+		Seconds:   percentiles(seconds),
+	}
+	return
+}
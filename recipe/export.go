@@ -0,0 +1,120 @@
+package recipe
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportFormats are the formats a graph can be exported as, with their
+// content types
+var ExportFormats = map[string]string{
+	"dot":     "text/vnd.graphviz; charset=utf-8",
+	"svg":     "image/svg+xml",
+	"mermaid": "text/plain; charset=utf-8",
+	"json":    "application/json",
+}
+
+// ExportGraph writes the graph in the format, which is one of
+// ExportFormats, in the colors of the theme
+func ExportGraph(ctx context.Context, g Graph, format string, theme Theme, w io.Writer) (err error) {
+	switch format {
+	case "dot":
+		_, err = io.WriteString(w, g.DOT(theme))
+	case "svg":
+		err = SVGRenderer{Theme: theme}.Render(ctx, g, w)
+	case "mermaid":
+		_, err = io.WriteString(w, g.Mermaid(theme))
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(g.JSONGraph())
+	default:
+		err = fmt.Errorf("unknown format %s", format)
+	}
+	return
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.Replace(s, `"`, "#quot;", -1) + `"`
+}
+
+// Mermaid returns the graph as a Mermaid flowchart, with the made products
+// as rounded boxes and the bought ones as stadiums
+func (g Graph) Mermaid(theme Theme) string {
+	theme = theme.orDefault()
+	var b strings.Builder
+	b.WriteString("flowchart TB\n")
+	ids := make(map[string]string)
+	for i, node := range g.Nodes {
+		ids[node.Name] = fmt.Sprintf("n%d", i+1)
+		if node.Made {
+			fmt.Fprintf(&b, "  %s(%s):::made\n", ids[node.Name], mermaidQuote(node.Name))
+		} else {
+			fmt.Fprintf(&b, "  %s([%s]):::bought\n", ids[node.Name], mermaidQuote(node.Name))
+		}
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "  %s -->|%s| %s\n", ids[edge.From], mermaidQuote(edge.Label()), ids[edge.To])
+	}
+	fill := func(f string) string {
+		if f == "" {
+			return "none"
+		}
+		return f
+	}
+	fmt.Fprintf(&b, "  classDef made fill:%s,stroke:%s,color:%s,stroke-width:2px\n", fill(theme.MadeFill), theme.Color, theme.Color)
+	fmt.Fprintf(&b, "  classDef bought fill:%s,stroke:%s,color:%s,stroke-dasharray:4 3\n", fill(theme.BoughtFill), theme.Color, theme.Color)
+	fmt.Fprintf(&b, "  linkStyle default stroke:%s,color:%s\n", theme.Color, theme.Color)
+	return b.String()
+}
+
+// JSONGraph is a graph in the JSON Graph Format (https://jsongraphformat.info),
+// version 2
+type JSONGraph struct {
+	Graph struct {
+		Directed bool                     `json:"directed"`
+		Label    string                   `json:"label"`
+		Nodes    map[string]JSONGraphNode `json:"nodes"`
+		Edges    []JSONGraphEdge          `json:"edges"`
+	} `json:"graph"`
+}
+
+// JSONGraphNode is a product, where the key is its name
+type JSONGraphNode struct {
+	Label    string    `json:"label"`
+	Metadata GraphNode `json:"metadata"`
+}
+
+// JSONGraphEdge is how much of the source goes into the target
+type JSONGraphEdge struct {
+	Source   string   `json:"source"`
+	Target   string   `json:"target"`
+	Label    string   `json:"label"`
+	Metadata Quantity `json:"metadata"`
+}
+
+// JSONGraph returns the graph in the JSON Graph Format, labeled with the
+// recipe
+func (g Graph) JSONGraph() (jg JSONGraph) {
+	jg.Graph.Directed = true
+	jg.Graph.Nodes = make(map[string]JSONGraphNode)
+	jg.Graph.Edges = []JSONGraphEdge{}
+	if len(g.Nodes) > 0 {
+		jg.Graph.Label = g.Nodes[0].Name
+	}
+	for _, node := range g.Nodes {
+		jg.Graph.Nodes[node.Name] = JSONGraphNode{Label: node.Name, Metadata: node}
+	}
+	for _, edge := range g.Edges {
+		jg.Graph.Edges = append(jg.Graph.Edges, JSONGraphEdge{
+			Source:   edge.From,
+			Target:   edge.To,
+			Label:    edge.Label(),
+			Metadata: edge.Quantity,
+		})
+	}
+	return
+}
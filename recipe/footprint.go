@@ -0,0 +1,140 @@
+package recipe
+
+import "math"
+
+// squareMetersPerAcre converts the "acre" measure into land area
+const squareMetersPerAcre = 4046.86
+
+// Footprint is the environmental footprint of some amount of food. Land is
+// square meters, water is liters, CO2e is kilograms of CO2 equivalent and
+// energy is kWh.
+type Footprint struct {
+	Land   float64 `toml:"land" json:"land"`
+	Water  float64 `toml:"water" json:"water"`
+	CO2e   float64 `toml:"co2e" json:"co2e"`
+	Energy float64 `toml:"energy" json:"energy"`
+}
+
+func (f Footprint) add(f2 Footprint) Footprint {
+	return Footprint{
+		Land:   f.Land + f2.Land,
+		Water:  f.Water + f2.Water,
+		CO2e:   f.CO2e + f2.CO2e,
+		Energy: f.Energy + f2.Energy,
+	}
+}
+
+func (f Footprint) scale(scaling float64) Footprint {
+	return Footprint{
+		Land:   f.Land * scaling,
+		Water:  f.Water * scaling,
+		CO2e:   f.CO2e * scaling,
+		Energy: f.Energy * scaling,
+	}
+}
+
+func (f Footprint) round() Footprint {
+	r := func(x float64) float64 { return math.Round(x*100) / 100 }
+	return Footprint{
+		Land:   r(f.Land),
+		Water:  r(f.Water),
+		CO2e:   r(f.CO2e),
+		Energy: r(f.Energy),
+	}
+}
+
+// UpdateAppFootprint is the footprint of the plan. StoreBought is the
+// footprint of buying the recipe and Scratch is the footprint of making
+// everything in it from scratch, when either is known.
+type UpdateAppFootprint struct {
+	Total       Footprint  `json:"total"`
+	StoreBought *Footprint `json:"storeBought,omitempty"`
+	Scratch     *Footprint `json:"scratch,omitempty"`
+}
+
+// boughtFootprint returns the footprint of buying the element, which is
+// the footprint of its product, the land if it is measured in acres, or
+// otherwise the footprint of making it from scratch.
+func boughtFootprint(reactions map[string]Reaction, e Element, depth int) (f Footprint, ok bool) {
+	if e.Measure == "acre" {
+		return Footprint{Land: e.Amount * squareMetersPerAcre}, true
+	}
+	reaction, hasReaction := reactions[e.Name]
+	if !hasReaction || depth > 20 {
+		return
+	}
+	product := reaction.Product[0]
+	amount, converted := convertMeasure(e.Amount, e.Measure, product.Measure)
+	if !converted || product.Amount == 0 {
+		return
+	}
+	if product.Footprint != nil {
+		return product.Footprint.scale(amount / product.Amount), true
+	}
+	return scratchFootprint(reactions, e.Name, amount, depth+1)
+}
+
+// reactionFootprint returns the footprint of the reaction itself when
+// making the amount of its product.
+func reactionFootprint(reactions map[string]Reaction, name string, amount float64) (f Footprint, ok bool) {
+	reaction, hasReaction := reactions[name]
+	if !hasReaction || reaction.Footprint == nil || reaction.Product[0].Amount == 0 {
+		return
+	}
+	return reaction.Footprint.scale(amount / reaction.Product[0].Amount), true
+}
+
+// scratchFootprint returns the footprint of making the amount of the
+// product, including everything it is made from.
+func scratchFootprint(reactions map[string]Reaction, name string, amount float64, depth int) (f Footprint, ok bool) {
+	reaction, hasReaction := reactions[name]
+	if !hasReaction || len(reaction.Reactant) == 0 || reaction.Product[0].Amount == 0 {
+		return
+	}
+	f, ok = reactionFootprint(reactions, name, amount)
+	scaling := amount / reaction.Product[0].Amount
+	for _, reactant := range reaction.Reactant {
+		reactant.Amount *= scaling
+		f2, ok2 := boughtFootprint(reactions, reactant, depth)
+		if ok2 {
+			f = f.add(f2)
+			ok = true
+		}
+	}
+	return
+}
+
+// planFootprint adds up the footprint of everything that is made and
+// everything that is bought in the (pruned) tree.
+func planFootprint(d *Dag, reactions map[string]Reaction) (f Footprint, ok bool) {
+	if len(d.Children) == 0 {
+		return boughtFootprint(reactions, d.Product, 0)
+	}
+	f, ok = reactionFootprint(reactions, d.Product.Name, d.Product.Amount)
+	for _, child := range d.Children {
+		f2, ok2 := planFootprint(child, reactions)
+		if ok2 {
+			f = f.add(f2)
+			ok = true
+		}
+	}
+	return
+}
+
+func getPlanFootprint(d *Dag, reactions map[string]Reaction) (footprint *UpdateAppFootprint) {
+	total, ok := planFootprint(d, reactions)
+	if !ok {
+		return
+	}
+	footprint = &UpdateAppFootprint{Total: total.round()}
+	product := reactions[d.Product.Name].Product[0]
+	if product.Footprint != nil {
+		storeBought := product.Footprint.scale(d.Product.Amount / product.Amount).round()
+		footprint.StoreBought = &storeBought
+	}
+	if scratch, ok := scratchFootprint(reactions, d.Product.Name, d.Product.Amount, 0); ok {
+		scratch = scratch.round()
+		footprint.Scratch = &scratch
+	}
+	return
+}
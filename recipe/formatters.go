@@ -13,6 +13,12 @@ func FormatCookingRational(num float64) (s string) {
 	// log.Debug((num - wholeNum) / 8)
 	fractionNum := (math.Round((num-wholeNum)*8) / 8) / .125
 	// log.Debug(wholeNum, fractionNum)
+	if fractionNum == 8 {
+		// rounds up to the next whole number, without which e.g. 0.97
+		// teaspoons of salt would be written as "teaspoon salt"
+		wholeNum++
+		fractionNum = 0
+	}
 	if wholeNum > 0 {
 		s = fmt.Sprintf("%2.0f", wholeNum)
 	}
@@ -49,6 +55,34 @@ func convertCups(cups float64) (amount float64, measure string) {
 	return
 }
 
+// cupsPerMeasure is the number of cups in each volume measure
+var cupsPerMeasure = map[string]float64{
+	"cup":        1,
+	"tablespoon": 1.0 / 16,
+	"teaspoon":   1.0 / 48,
+	"tsp":        1.0 / 48,
+}
+
+// IsMeasure is whether the catalog uses the measure
+func IsMeasure(measure string) bool {
+	_, ok := cupsPerMeasure[measure]
+	return ok || measure == "whole" || measure == "acre"
+}
+
+// convertMeasure converts the amount from one measure to another, which
+// only works between volumes or between identical measures.
+func convertMeasure(amount float64, from string, to string) (float64, bool) {
+	if from == to {
+		return amount, true
+	}
+	fromCups, ok1 := cupsPerMeasure[from]
+	toCups, ok2 := cupsPerMeasure[to]
+	if !ok1 || !ok2 {
+		return 0, false
+	}
+	return amount * fromCups / toCups, true
+}
+
 func FormatMeasure(amount float64, measure string) (s string) {
 	if measure == "cup" {
 		amount, measure = convertCups(amount)
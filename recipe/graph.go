@@ -0,0 +1,413 @@
+package recipe
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/cache"
+)
+
+// Graph is the graph of a (pruned) tree, where every product is a single
+// node and each edge goes from an ingredient to what it is used in
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphNode is a product of the graph. Rank is the longest path to the
+// recipe, which has rank 0, and Cluster is the product that a bought
+// ingredient is grouped with.
+type GraphNode struct {
+	Name    string `json:"name"`
+	Made    bool   `json:"made"`
+	Rank    int    `json:"rank"`
+	Cluster string `json:"cluster"`
+}
+
+// GraphEdge is how much of an ingredient goes into a product
+type GraphEdge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Quantity Quantity `json:"quantity"`
+}
+
+// Label is the amount of the edge, e.g. "1 ⅜ cups"
+func (e GraphEdge) Label() string {
+	return FormatQuantity(e.Quantity)
+}
+
+// NewGraph returns the graph of the (pruned) tree
+func NewGraph(d *Dag) Graph {
+	nodes, _ := planNodes(d, 0, []PlanNode{})
+	return graphFromNodes(nodes)
+}
+
+// PlanGraph returns the graph of the plan
+func PlanGraph(plan Plan) Graph {
+	return graphFromNodes(plan.Nodes)
+}
+
+// graphFromNodes merges the nodes of the tree with the same product, with
+// the nodes in the order they are first found
+func graphFromNodes(planNodes []PlanNode) (g Graph) {
+	g = Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	nodes := make(map[string]int)
+	// edges are keyed by their products and their unit, since the same
+	// ingredient can go into a product in different units
+	edges := make(map[[3]string]int)
+	ranks := make([]int, len(planNodes))
+	for i, node := range planNodes {
+		cluster := node.Name
+		if node.Parent > 0 {
+			ranks[i] = ranks[node.Parent-1] + 1
+			cluster = planNodes[node.Parent-1].Name
+		}
+		n, ok := nodes[node.Name]
+		if !ok {
+			n = len(g.Nodes)
+			nodes[node.Name] = n
+			g.Nodes = append(g.Nodes, GraphNode{Name: node.Name, Rank: ranks[i], Cluster: cluster})
+		}
+		if node.Made {
+			g.Nodes[n].Made = true
+			g.Nodes[n].Cluster = node.Name
+		}
+		if ranks[i] > g.Nodes[n].Rank {
+			g.Nodes[n].Rank = ranks[i]
+		}
+		if node.Parent == 0 {
+			continue
+		}
+		key := [3]string{node.Name, planNodes[node.Parent-1].Name, node.Quantity.Unit}
+		if e, ok := edges[key]; ok {
+			g.Edges[e].Quantity.Value += node.Quantity.Value
+		} else {
+			edges[key] = len(g.Edges)
+			g.Edges = append(g.Edges, GraphEdge{From: key[0], To: key[1], Quantity: node.Quantity})
+		}
+	}
+	return
+}
+
+// Theme is the colors of a drawn graph, where the fills can be empty
+type Theme struct {
+	Background string `json:"background"`
+	Color      string `json:"color"`
+	MadeFill   string `json:"madeFill"`
+	BoughtFill string `json:"boughtFill"`
+}
+
+// Themes are the themes of graphs. "app" is white on the transparent
+// background of the app, and is the default.
+var Themes = map[string]Theme{
+	"app":   {Background: "#357EDD00", Color: "white"},
+	"light": {Background: "#FFFFFF", Color: "#333333", MadeFill: "#E8F0FB", BoughtFill: "#FFFFFF"},
+	"dark":  {Background: "#1E1E1E", Color: "#EEEEEE", MadeFill: "#2F4A6D", BoughtFill: "#1E1E1E"},
+}
+
+// GetTheme returns the theme with the name, where "" is "app"
+func GetTheme(name string) (theme Theme, err error) {
+	if name == "" {
+		name = "app"
+	}
+	theme, ok := Themes[name]
+	if !ok {
+		err = fmt.Errorf("unknown theme %s", name)
+	}
+	return
+}
+
+func (theme Theme) orDefault() Theme {
+	if theme == (Theme{}) {
+		return Themes["app"]
+	}
+	return theme
+}
+
+// dotEscaper escapes what can't be in a quoted DOT string as it is
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// DOT returns the graph in the DOT language of graphviz. Made products are
+// bold boxes and bought ones are dashed ellipses, every made product is
+// grouped with the ingredients that are bought for it, and the edges are
+// labeled with the amounts. The zero theme is the "app" theme.
+func (g Graph) DOT(theme Theme) string {
+	theme = theme.orDefault()
+	var b strings.Builder
+	fmt.Fprintf(&b, `digraph G {
+color=%s
+bgcolor=%s
+node [color=%s, fontcolor=%s];
+edge [color=%s, fontcolor=%s, fontsize=10];
+`, dotQuote(theme.Color), dotQuote(theme.Background), dotQuote(theme.Color), dotQuote(theme.Color), dotQuote(theme.Color), dotQuote(theme.Color))
+	clusters := make(map[string][]GraphNode)
+	for _, node := range g.Nodes {
+		clusters[node.Cluster] = append(clusters[node.Cluster], node)
+	}
+	written := make(map[string]struct{})
+	writeNode := func(indent string, node GraphNode) {
+		style := `shape=ellipse, style="dashed`
+		fill := theme.BoughtFill
+		if node.Made {
+			style = `shape=box, style="rounded,bold`
+			fill = theme.MadeFill
+		}
+		if fill != "" {
+			style += `,filled", fillcolor=` + dotQuote(fill)
+		} else {
+			style += `"`
+		}
+		fmt.Fprintf(&b, "%s%s [%s];\n", indent, dotQuote(node.Name), style)
+		written[node.Name] = struct{}{}
+	}
+	for i, node := range g.Nodes {
+		members := clusters[node.Name]
+		if !node.Made || len(members) == 1 {
+			continue
+		}
+		fmt.Fprintf(&b, "subgraph cluster_%d {\nlabel=%s;\nfontcolor=%s;\nstyle=\"dotted\";\n", i, dotQuote("make "+node.Name), dotQuote(theme.Color))
+		for _, member := range members {
+			writeNode("  ", member)
+		}
+		b.WriteString("}\n")
+	}
+	for _, node := range g.Nodes {
+		if _, ok := written[node.Name]; !ok {
+			writeNode("", node)
+		}
+	}
+	for _, edge := range g.Edges {
+		fmt.Fprintf(&b, "%s -> %s [label=%s];\n", dotQuote(edge.From), dotQuote(edge.To), dotQuote(edge.Label()))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// GenerateDOT returns the graph of the (pruned) tree in the DOT language
+func GenerateDOT(d *Dag) string {
+	return NewGraph(d).DOT(Theme{})
+}
+
+// Renderer draws a graph as an image
+type Renderer interface {
+	// Ext is the extension of the images, e.g. "png"
+	Ext() string
+	Render(ctx context.Context, g Graph, w io.Writer) error
+}
+
+// GraphvizRenderer renders with the dot command of graphviz
+type GraphvizRenderer struct {
+	// Format is the output format of dot, e.g. "png" or "svg"
+	Format string
+	Theme  Theme
+}
+
+// Ext is the format
+func (r GraphvizRenderer) Ext() string {
+	return r.Format
+}
+
+// Render runs dot, returning what it printed if it fails
+func (r GraphvizRenderer) Render(ctx context.Context, g Graph, w io.Writer) (err error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "dot", "-T"+r.Format)
+	cmd.Stdin = strings.NewReader(g.DOT(r.Theme))
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+		err = fmt.Errorf("dot: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return
+}
+
+// SVGRenderer lays out the graph itself, so it works without graphviz. The
+// ingredients are in rows above what they are used in, with the recipe at
+// the bottom.
+type SVGRenderer struct {
+	Theme Theme
+}
+
+// Ext is "svg"
+func (SVGRenderer) Ext() string {
+	return "svg"
+}
+
+const (
+	svgMargin     = 20
+	svgRowHeight  = 90
+	svgNodeHeight = 30
+	svgNodeGap    = 20
+	svgCharWidth  = 7
+)
+
+// GraphBox is where a node is drawn, from the top left
+type GraphBox struct {
+	X, Y, Width, Height float64
+}
+
+// Layout returns where every node is drawn, and the size of the drawing.
+// The ingredients are in rows above what they are used in.
+func (g Graph) Layout() (boxes map[string]GraphBox, width, height float64) {
+	maxRank := 0
+	for _, node := range g.Nodes {
+		if node.Rank > maxRank {
+			maxRank = node.Rank
+		}
+	}
+	rows := make([][]GraphNode, maxRank+1)
+	for _, node := range g.Nodes {
+		rows[node.Rank] = append(rows[node.Rank], node)
+	}
+
+	// order each row by where the products they are used in are, from the
+	// recipe up
+	order := make(map[string]float64)
+	for rank, row := range rows {
+		position := make(map[string]float64)
+		for _, node := range row {
+			total, count := 0.0, 0.0
+			for _, edge := range g.Edges {
+				if p, ok := order[edge.To]; ok && edge.From == node.Name {
+					total += p
+					count++
+				}
+			}
+			if count > 0 {
+				position[node.Name] = total / count
+			}
+		}
+		sort.SliceStable(row, func(i, j int) bool {
+			return position[row[i].Name] < position[row[j].Name]
+		})
+		for i, node := range row {
+			order[node.Name] = (float64(i) + 0.5) / float64(len(row))
+		}
+		rows[rank] = row
+	}
+
+	rowWidths := make([]float64, len(rows))
+	for rank, row := range rows {
+		for i, node := range row {
+			if i > 0 {
+				rowWidths[rank] += svgNodeGap
+			}
+			rowWidths[rank] += nodeWidth(node)
+		}
+		if rowWidths[rank] > width {
+			width = rowWidths[rank]
+		}
+	}
+	boxes = make(map[string]GraphBox)
+	for rank, row := range rows {
+		x := svgMargin + (width-rowWidths[rank])/2
+		y := svgMargin + float64(maxRank-rank)*svgRowHeight
+		for _, node := range row {
+			boxes[node.Name] = GraphBox{X: x, Y: y, Width: nodeWidth(node), Height: svgNodeHeight}
+			x += nodeWidth(node) + svgNodeGap
+		}
+	}
+	width += 2 * svgMargin
+	height = 2*svgMargin + float64(maxRank)*svgRowHeight + svgNodeHeight
+	return
+}
+
+func nodeWidth(node GraphNode) float64 {
+	return float64(len([]rune(node.Name))*svgCharWidth + 20)
+}
+
+// Render writes the graph as an SVG, in the colors of the theme
+func (r SVGRenderer) Render(ctx context.Context, g Graph, w io.Writer) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	theme := r.Theme.orDefault()
+	color := html.EscapeString(theme.Color)
+	fill := func(f string) string {
+		if f == "" {
+			return "none"
+		}
+		return html.EscapeString(f)
+	}
+	boxes, width, height := g.Layout()
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="Times,serif" font-size="13">
+<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="8" markerHeight="8" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="%s"/></marker></defs>
+<rect width="100%%" height="100%%" fill="%s"/>
+`, width, height, width, height, color, fill(theme.Background))
+	for _, edge := range g.Edges {
+		from, to := boxes[edge.From], boxes[edge.To]
+		x1, y1 := from.X+from.Width/2, from.Y+from.Height
+		x2, y2 := to.X+to.Width/2, to.Y
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" marker-end="url(#arrow)"/>`+"\n", x1, y1, x2, y2, color)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s" font-size="10" text-anchor="middle">%s</text>`+"\n", (x1+x2)/2, (y1+y2)/2, color, html.EscapeString(edge.Label()))
+	}
+	for _, node := range g.Nodes {
+		box := boxes[node.Name]
+		if node.Made {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="6" fill="%s" stroke="%s" stroke-width="2"/>`+"\n", box.X, box.Y, box.Width, box.Height, fill(theme.MadeFill), color)
+		} else {
+			fmt.Fprintf(&b, `<ellipse cx="%.1f" cy="%.1f" rx="%.1f" ry="%.1f" fill="%s" stroke="%s" stroke-dasharray="4,3"/>`+"\n", box.X+box.Width/2, box.Y+box.Height/2, box.Width/2, box.Height/2, fill(theme.BoughtFill), color)
+		}
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" fill="%s" text-anchor="middle">%s</text>`+"\n", box.X+box.Width/2, box.Y+box.Height/2+4, color, html.EscapeString(node.Name))
+	}
+	b.WriteString("</svg>\n")
+	_, err = io.WriteString(w, b.String())
+	return
+}
+
+// GraphRenderer renders the graphs of plans, which is graphviz if dot is
+// installed and otherwise the SVG renderer
+var GraphRenderer Renderer = defaultRenderer()
+
+func defaultRenderer() Renderer {
+	if _, err := exec.LookPath("dot"); err == nil {
+		return GraphvizRenderer{Format: "png"}
+	}
+	return SVGRenderer{}
+}
+
+// NewRenderer returns the renderer with the name, which is "graphviz",
+// "svg" or "" for the default
+func NewRenderer(name string) (r Renderer, err error) {
+	switch name {
+	case "":
+		r = defaultRenderer()
+	case "graphviz":
+		r = GraphvizRenderer{Format: "png"}
+	case "svg":
+		r = SVGRenderer{}
+	default:
+		err = fmt.Errorf("unknown renderer %s", name)
+	}
+	return
+}
+
+// GraphCache keeps the rendered graphs
+var GraphCache = cache.New("graphviz", cache.Options{MaxBytes: 100 << 20})
+
+// getGraphviz renders the graph of the tree into the graph cache, named by
+// the hash of the graph, and returns the name of the file
+func getGraphviz(ctx context.Context, d *Dag) (graphvizFileName string, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	g := NewGraph(d)
+	renderer := GraphRenderer
+	return GraphCache.Get(ctx, GetMD5Hash(g.DOT(Theme{}))+"."+renderer.Ext(), func(ctx context.Context, w io.Writer) error {
+		return renderer.Render(ctx, g, w)
+	})
+}
@@ -0,0 +1,45 @@
+package recipe
+
+import (
+	"regexp"
+	"strings"
+)
+
+// NoteLink is a piece of a note, which links to the URL if there is one
+type NoteLink struct {
+	Text string `json:"text"`
+	URL  string `json:"url,omitempty"`
+}
+
+// markdownLink matches [text](url) and bare urls
+var markdownLink = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)|https?://[^\s)\]]+`)
+
+// ParseNotes splits the Markdown of notes into lines, and each line into
+// text and links
+func ParseNotes(markdown string) (lines [][]NoteLink) {
+	lines = [][]NoteLink{}
+	for _, line := range strings.Split(strings.TrimSpace(markdown), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		links := []NoteLink{}
+		last := 0
+		for _, m := range markdownLink.FindAllStringSubmatchIndex(line, -1) {
+			if m[0] > last {
+				links = append(links, NoteLink{Text: line[last:m[0]]})
+			}
+			if m[2] >= 0 {
+				links = append(links, NoteLink{Text: line[m[2]:m[3]], URL: line[m[4]:m[5]]})
+			} else {
+				links = append(links, NoteLink{Text: line[m[0]:m[1]], URL: line[m[0]:m[1]]})
+			}
+			last = m[1]
+		}
+		if last < len(line) {
+			links = append(links, NoteLink{Text: line[last:]})
+		}
+		lines = append(lines, links)
+	}
+	return
+}
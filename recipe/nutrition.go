@@ -0,0 +1,266 @@
+package recipe
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Nutrition is the nutrition of some amount of food. Calories are kcal,
+// sodium is in milligrams and everything else is in grams.
+type Nutrition struct {
+	Calories float64 `toml:"calories" json:"calories"`
+	Protein  float64 `toml:"protein" json:"protein"`
+	Fat      float64 `toml:"fat" json:"fat"`
+	Carbs    float64 `toml:"carbs" json:"carbs"`
+	Fiber    float64 `toml:"fiber" json:"fiber"`
+	Sodium   float64 `toml:"sodium" json:"sodium"`
+}
+
+func (n Nutrition) add(n2 Nutrition) Nutrition {
+	return Nutrition{
+		Calories: n.Calories + n2.Calories,
+		Protein:  n.Protein + n2.Protein,
+		Fat:      n.Fat + n2.Fat,
+		Carbs:    n.Carbs + n2.Carbs,
+		Fiber:    n.Fiber + n2.Fiber,
+		Sodium:   n.Sodium + n2.Sodium,
+	}
+}
+
+func (n Nutrition) scale(scaling float64) Nutrition {
+	return Nutrition{
+		Calories: n.Calories * scaling,
+		Protein:  n.Protein * scaling,
+		Fat:      n.Fat * scaling,
+		Carbs:    n.Carbs * scaling,
+		Fiber:    n.Fiber * scaling,
+		Sodium:   n.Sodium * scaling,
+	}
+}
+
+// round rounds everything to a tenth, which is plenty for a label
+func (n Nutrition) round() Nutrition {
+	r := func(f float64) float64 { return math.Round(f*10) / 10 }
+	return Nutrition{
+		Calories: r(n.Calories),
+		Protein:  r(n.Protein),
+		Fat:      r(n.Fat),
+		Carbs:    r(n.Carbs),
+		Fiber:    r(n.Fiber),
+		Sodium:   r(n.Sodium),
+	}
+}
+
+// FoodData Central nutrient ids, see nutrient.csv in the download
+const (
+	fdcProtein  = 1003
+	fdcFat      = 1004
+	fdcCarbs    = 1005
+	fdcCalories = 1008
+	fdcFiber    = 1079
+	fdcSodium   = 1093
+)
+
+// foodDataCentral is the nutrition per 100 grams keyed by fdc_id, loaded
+// by LoadFoodDataCentral.
+var foodDataCentral map[int]Nutrition
+
+// LoadFoodDataCentral loads a local copy of the USDA FoodData Central
+// food_nutrient.csv. Afterwards any product that specifies a fdc_id and
+// its weight in grams, but no nutrition, gets its nutrition from it.
+func LoadFoodDataCentral(fname string) (err error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	foods, err := ReadFoodDataCentral(f)
+	if err != nil {
+		return
+	}
+	foodDataCentral = foods
+	return
+}
+
+// ReadFoodDataCentral parses a FoodData Central food_nutrient.csv into the
+// nutrition per 100 grams of each food, keyed by fdc_id.
+func ReadFoodDataCentral(r io.Reader) (foods map[int]Nutrition, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	for _, name := range []string{"fdc_id", "nutrient_id", "amount"} {
+		if _, ok := columns[name]; !ok {
+			err = errors.New("food_nutrient csv is missing column " + name)
+			return
+		}
+	}
+
+	foods = make(map[int]Nutrition)
+	for {
+		var record []string
+		record, err = reader.Read()
+		if err == io.EOF {
+			err = nil
+			break
+		} else if err != nil {
+			return
+		}
+		if len(record) < len(header) {
+			continue
+		}
+		fdcID, errID := strconv.Atoi(record[columns["fdc_id"]])
+		nutrientID, errNutrient := strconv.Atoi(record[columns["nutrient_id"]])
+		amount, errAmount := strconv.ParseFloat(record[columns["amount"]], 64)
+		if errID != nil || errNutrient != nil || errAmount != nil {
+			continue
+		}
+		n := foods[fdcID]
+		switch nutrientID {
+		case fdcCalories:
+			n.Calories = amount
+		case fdcProtein:
+			n.Protein = amount
+		case fdcFat:
+			n.Fat = amount
+		case fdcCarbs:
+			n.Carbs = amount
+		case fdcFiber:
+			n.Fiber = amount
+		case fdcSodium:
+			n.Sodium = amount
+		default:
+			continue
+		}
+		foods[fdcID] = n
+	}
+	return
+}
+
+func applyFoodDataCentral(reactions map[string]Reaction) {
+	if foodDataCentral == nil {
+		return
+	}
+	for name, reaction := range reactions {
+		product := reaction.Product[0]
+		if product.Nutrition != nil || product.FoodDataID == 0 || product.Grams == 0 {
+			continue
+		}
+		per100g, ok := foodDataCentral[product.FoodDataID]
+		if !ok {
+			continue
+		}
+		n := per100g.scale(product.Grams / 100)
+		product.Nutrition = &n
+		reaction.Product = []Element{product}
+		reactions[name] = reaction
+	}
+}
+
+// nutritionOf returns the nutrition of the element, either from the
+// nutrition of the product or, if the product doesn't have any, from the
+// nutrition of the reactants that make it. Whatever has no nutrition to go
+// by is missing, and ok is whether anything had some.
+func nutritionOf(reactions map[string]Reaction, e Element, depth int) (n Nutrition, ok bool, missing []string) {
+	reaction, hasReaction := reactions[e.Name]
+	if !hasReaction || depth > 20 {
+		return n, false, []string{e.Name}
+	}
+	product := reaction.Product[0]
+	amount, converted := convertMeasure(e.Amount, e.Measure, product.Measure)
+	if !converted || product.Amount == 0 {
+		return n, false, []string{e.Name}
+	}
+	if product.Nutrition != nil {
+		return product.Nutrition.scale(amount / product.Amount), true, nil
+	}
+	return scratchNutrition(reactions, e.Name, amount, depth+1)
+}
+
+// scratchNutrition returns the nutrition of making the amount of the
+// product from its reactants.
+func scratchNutrition(reactions map[string]Reaction, name string, amount float64, depth int) (n Nutrition, ok bool, missing []string) {
+	reaction, hasReaction := reactions[name]
+	if !hasReaction || reaction.Product[0].Amount == 0 || len(reaction.Reactant) == 0 {
+		return n, false, []string{name}
+	}
+	scaling := amount / reaction.Product[0].Amount
+	for _, reactant := range reaction.Reactant {
+		reactant.Amount *= scaling
+		n2, ok2, missing2 := nutritionOf(reactions, reactant, depth)
+		if ok2 {
+			n = n.add(n2)
+			ok = true
+		}
+		missing = append(missing, missing2...)
+	}
+	return
+}
+
+// planNutrition adds up the nutrition of everything that is bought in the
+// (pruned) tree.
+func planNutrition(d *Dag, reactions map[string]Reaction) (n Nutrition, ok bool, missing []string) {
+	if len(d.Children) == 0 {
+		return nutritionOf(reactions, d.Product, 0)
+	}
+	for _, child := range d.Children {
+		n2, ok2, missing2 := planNutrition(child, reactions)
+		if ok2 {
+			n = n.add(n2)
+			ok = true
+		}
+		missing = append(missing, missing2...)
+	}
+	return
+}
+
+func getPlanNutrition(d *Dag, reactions map[string]Reaction) (nutrition *UpdateAppNutrition) {
+	total, ok, missing := planNutrition(d, reactions)
+	if !ok {
+		return
+	}
+	product := reactions[d.Product.Name].Product[0]
+	nutrition = &UpdateAppNutrition{
+		Total:    total.round(),
+		Servings: servingsInAmount(product, d.Product.Amount),
+		Complete: len(missing) == 0,
+		Missing:  uniqueSorted(missing),
+	}
+	if nutrition.Servings == 0 {
+		nutrition.Servings = 1
+	}
+	nutrition.PerServing = total.scale(1 / nutrition.Servings).round()
+	if product.Nutrition != nil {
+		storeBought := product.Nutrition.scale(d.Product.Amount / product.Amount).round()
+		nutrition.StoreBought = &storeBought
+	}
+	if scratch, ok, _ := scratchNutrition(reactions, d.Product.Name, d.Product.Amount, 0); ok {
+		scratch = scratch.round()
+		nutrition.Scratch = &scratch
+	}
+	return
+}
+
+// uniqueSorted returns the names once each, in order
+func uniqueSorted(names []string) (unique []string) {
+	have := make(map[string]bool)
+	for _, name := range names {
+		if !have[name] {
+			have[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return
+}
@@ -0,0 +1,203 @@
+package recipe
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// PlanVersion is the version of the Plan format, which goes up whenever a
+// field is removed or changes what it means
+const PlanVersion = 1
+
+// Plan is everything about making a recipe, with amounts in canonical
+// units, costs in cents and durations in seconds. The app gets it
+// formatted as an UpdateApp.
+type Plan struct {
+	Version  int      `json:"version"`
+	Recipe   string   `json:"recipe"`
+	Quantity Quantity `json:"quantity"`
+	Diet     []string `json:"diet,omitempty"`
+
+	CostCents int64 `json:"costCents"`
+	Seconds   int64 `json:"seconds"`
+
+	// Servings are the servings in the quantity, if the recipe has any
+	Servings            float64 `json:"servings,omitempty"`
+	ServingSize         string  `json:"servingSize,omitempty"`
+	CostPerServingCents int64   `json:"costPerServingCents,omitempty"`
+	SecondsPerServing   int64   `json:"secondsPerServing,omitempty"`
+
+	// Start and Ready are dates (YYYY-MM-DD), if the request has a start
+	Start string `json:"start,omitempty"`
+	Ready string `json:"ready,omitempty"`
+
+	// Graph is the name of the graphviz file of the plan
+	Graph string   `json:"graph"`
+	Tags  []string `json:"tags"`
+
+	// Nodes are the full tree, with the recipe first
+	Nodes       []PlanNode       `json:"nodes"`
+	Ingredients []PlanIngredient `json:"ingredients"`
+	Steps       []PlanStep       `json:"steps"`
+
+	Substitutions []UpdateAppSubstitution `json:"substitutions"`
+	Nutrition     *UpdateAppNutrition     `json:"nutrition,omitempty"`
+	Footprint     *UpdateAppFootprint     `json:"footprint,omitempty"`
+	Estimate      *PlanEstimate           `json:"estimate,omitempty"`
+	Sensitivity   *PlanSensitivity        `json:"sensitivity,omitempty"`
+}
+
+// Quantity is an amount in a canonical unit, which is "ml" for volumes,
+// "m2" for land and otherwise the measure itself (e.g. "whole").
+type Quantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+// PlanNode is a node of the tree. The recipe has ID 1 and every other node
+// has the ID of its Parent.
+type PlanNode struct {
+	ID       int      `json:"id"`
+	Parent   int      `json:"parent,omitempty"`
+	Children []int    `json:"children"`
+	Name     string   `json:"name"`
+	Quantity Quantity `json:"quantity"`
+	Made     bool     `json:"made"`
+	Reason   string   `json:"reason"`
+	Why      string   `json:"why"`
+	Depth    int      `json:"depth"`
+
+	// CostCents is the cost of buying everything for the node and Seconds
+	// is the time to make the node itself
+	CostCents int64 `json:"costCents"`
+	Seconds   int64 `json:"seconds"`
+}
+
+// PlanIngredient is something to buy
+type PlanIngredient struct {
+	Name      string       `json:"name"`
+	Quantity  Quantity     `json:"quantity"`
+	CostCents int64        `json:"costCents"`
+	Scratch   *PlanScratch `json:"scratch,omitempty"`
+	Tags      []string     `json:"tags"`
+	Reason    string       `json:"reason"`
+	Why       string       `json:"why"`
+
+	// Notes are where the price is from, in Markdown (see ParseNotes)
+	Notes string `json:"notes,omitempty"`
+}
+
+// PlanScratch is how much more it costs, and how long it takes, to make an
+// ingredient from scratch instead of buying it
+type PlanScratch struct {
+	CostDifferenceCents int64 `json:"costDifferenceCents"`
+	Seconds             int64 `json:"seconds"`
+}
+
+// PlanStep is something to make, in the order to make them
+type PlanStep struct {
+	Name    string   `json:"name"`
+	Seconds int64    `json:"seconds"`
+	Texts   []string `json:"texts"`
+	Tags    []string `json:"tags"`
+	Start   string   `json:"start,omitempty"`
+	Ready   string   `json:"ready,omitempty"`
+	Reason  string   `json:"reason"`
+	Why     string   `json:"why"`
+}
+
+const millilitersPerCup = 236.5882365
+
+func toCents(dollars float64) int64 {
+	return int64(math.Round(dollars * 100))
+}
+
+func toSeconds(hours float64) int64 {
+	return int64(math.Round(hours * 3600))
+}
+
+func canonicalQuantity(amount float64, measure string) Quantity {
+	if cups, ok := convertMeasure(amount, measure, "cup"); ok {
+		return Quantity{Value: cups * millilitersPerCup, Unit: "ml"}
+	}
+	if measure == "acre" {
+		return Quantity{Value: amount * squareMetersPerAcre, Unit: "m2"}
+	}
+	return Quantity{Value: amount, Unit: measure}
+}
+
+// measure returns the amount and measure that recipes use for the quantity
+func (q Quantity) measure() (amount float64, measure string) {
+	switch q.Unit {
+	case "ml":
+		return q.Value / millilitersPerCup, "cup"
+	case "m2":
+		return q.Value / squareMetersPerAcre, "acre"
+	}
+	return q.Value, q.Unit
+}
+
+// planNodes flattens the (pruned) tree, returning the cost of buying
+// everything for it
+func planNodes(d *Dag, parent int, nodes []PlanNode) ([]PlanNode, float64) {
+	id := len(nodes) + 1
+	nodes = append(nodes, PlanNode{
+		ID:       id,
+		Parent:   parent,
+		Children: []int{},
+		Name:     d.Product.Name,
+		Quantity: canonicalQuantity(d.Product.Amount, d.Product.Measure),
+		Made:     len(d.Children) > 0,
+		Reason:   d.Reason,
+		Why:      d.Why,
+		Depth:    d.Depth,
+	})
+	cost := 0.0
+	if len(d.Children) == 0 {
+		cost = d.Product.Price
+	} else {
+		nodes[id-1].Seconds = toSeconds(d.SerialHours + d.ParallelHours)
+	}
+	for _, child := range d.Children {
+		nodes[id-1].Children = append(nodes[id-1].Children, len(nodes)+1)
+		var childCost float64
+		nodes, childCost = planNodes(child, id, nodes)
+		cost += childCost
+	}
+	nodes[id-1].CostCents = toCents(cost)
+	return nodes, cost
+}
+
+// PlanTree draws the tree of the plan in ASCII, with what is made and how
+// long it takes, and what is bought and how much it costs
+func PlanTree(plan Plan) string {
+	return printTree(plan.Nodes)
+}
+
+func printTree(nodes []PlanNode) string {
+	var b strings.Builder
+	var print func(id int, prefix, branch, indent string)
+	print = func(id int, prefix, branch, indent string) {
+		node := nodes[id-1]
+		detail := fmt.Sprintf("buy, $%2.2f", toDollars(node.CostCents))
+		if node.Made {
+			detail = "make"
+			if node.Seconds > 0 {
+				detail += ", " + strings.ToLower(FormatDuration(toHours(node.Seconds)))
+			}
+		}
+		fmt.Fprintf(&b, "%s%s%s, %s (%s)\n", prefix, branch, node.Name, FormatQuantity(node.Quantity), detail)
+		for i, child := range node.Children {
+			if i == len(node.Children)-1 {
+				print(child, prefix+indent, "`-- ", "    ")
+			} else {
+				print(child, prefix+indent, "|-- ", "|   ")
+			}
+		}
+	}
+	if len(nodes) > 0 {
+		print(1, "", "", "")
+	}
+	return b.String()
+}
@@ -0,0 +1,165 @@
+package recipe
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// GetRecipeFromRequest computes the plan for everything in the request,
+// formatted for the app
+func GetRecipeFromRequest(request RequestFromApp) (payload UpdateApp, err error) {
+	return GetRecipeFromRequestContext(context.Background(), request)
+}
+
+// GetRecipeFromRequestContext is GetRecipeFromRequest, stopping once the
+// context is done
+func GetRecipeFromRequestContext(ctx context.Context, request RequestFromApp) (payload UpdateApp, err error) {
+	plan, err := GetPlanContext(ctx, request)
+	if err != nil {
+		return
+	}
+	payload = plan.UpdateApp()
+	return
+}
+
+func toDollars(cents int64) float64 {
+	return float64(cents) / 100
+}
+
+func toHours(seconds int64) float64 {
+	return float64(seconds) / 3600
+}
+
+// FormatQuantity formats the quantity like the recipes, e.g. "1 ⅜ cups"
+func FormatQuantity(q Quantity) string {
+	return FormatMeasure(q.measure())
+}
+
+// formatTime formats the duration, where nothing takes "No time"
+func formatTime(seconds int64) (s string) {
+	s = FormatDuration(toHours(seconds))
+	if s == "" {
+		s = "No time"
+	}
+	return
+}
+
+// UpdateApp formats the plan for the app
+func (plan Plan) UpdateApp() (payload UpdateApp) {
+	payload.Version = "v0.0.0"
+	payload.Recipe = plan.Recipe
+	payload.Diet = plan.Diet
+	payload.Amount, payload.Measure = plan.Quantity.measure()
+	payload.Graph = plan.Graph
+	payload.MinutesToBuild = float64(plan.Seconds) / 60
+	payload.TotalTime = formatTime(plan.Seconds)
+	payload.TotalCost = FormatCost(toDollars(plan.CostCents))
+	if len(payload.TotalCost) > 1 {
+		payload.TotalCost = payload.TotalCost[1:]
+	} else {
+		payload.TotalCost = "$0"
+	}
+
+	payload.Ingredients = make([]UpdateAppIngredients, len(plan.Ingredients))
+	for i, ing := range plan.Ingredients {
+		payload.Ingredients[i] = UpdateAppIngredients{
+			Name:   ing.Name,
+			Amount: FormatQuantity(ing.Quantity),
+			Cost:   fmt.Sprintf("$%2.2f", toDollars(ing.CostCents)),
+			Tags:   ing.Tags,
+			Reason: ing.Reason,
+			Why:    ing.Why,
+		}
+		if ing.Scratch != nil {
+			payload.Ingredients[i].ScratchCost = FormatCost(toDollars(ing.Scratch.CostDifferenceCents))
+			payload.Ingredients[i].ScratchTime = FormatDuration(toHours(ing.Scratch.Seconds))
+		}
+	}
+	payload.Directions = make([]UpdateAppDirections, len(plan.Steps))
+	for i, step := range plan.Steps {
+		payload.Directions[i] = UpdateAppDirections{
+			Name:      step.Name,
+			TotalTime: FormatDuration(toHours(step.Seconds)),
+			Texts:     step.Texts,
+			Tags:      step.Tags,
+			Start:     step.Start,
+			Ready:     step.Ready,
+			Reason:    step.Reason,
+			Why:       step.Why,
+		}
+	}
+
+	if plan.Servings > 0 {
+		payload.Servings = plan.Servings
+		payload.ServingSize = plan.ServingSize
+		payload.CostPerServing = fmt.Sprintf("$%2.2f", toDollars(plan.CostPerServingCents))
+		payload.TimePerServing = formatTime(plan.SecondsPerServing)
+	}
+	payload.Start = plan.Start
+	payload.Ready = plan.Ready
+	payload.Tags = plan.Tags
+	payload.Substitutions = plan.Substitutions
+	payload.Nutrition = plan.Nutrition
+	payload.Footprint = plan.Footprint
+	if plan.Estimate != nil {
+		payload.Estimate = presentEstimate(*plan.Estimate)
+	}
+	if plan.Sensitivity != nil {
+		payload.Sensitivity = presentSensitivity(*plan.Sensitivity)
+	}
+	return
+}
+
+func presentEstimate(estimate PlanEstimate) *UpdateAppEstimate {
+	hours := func(seconds float64) float64 {
+		return math.Round(seconds/3600*100) / 100
+	}
+	return &UpdateAppEstimate{
+		Samples: estimate.Samples,
+		Seed:    estimate.Seed,
+		Cost: Percentiles{
+			P10:    estimate.CostCents.P10 / 100,
+			Median: estimate.CostCents.Median / 100,
+			P90:    estimate.CostCents.P90 / 100,
+		},
+		Hours: Percentiles{
+			P10:    hours(estimate.Seconds.P10),
+			Median: hours(estimate.Seconds.Median),
+			P90:    hours(estimate.Seconds.P90),
+		},
+	}
+}
+
+func presentInputs(inputs []PlanInput, perUnit float64) (sensitivities []Sensitivity) {
+	sensitivities = make([]Sensitivity, len(inputs))
+	for i, input := range inputs {
+		sensitivities[i] = Sensitivity{
+			Name:   input.Name,
+			Per:    FormatQuantity(input.Per),
+			Value:  math.Round(input.Value/perUnit*1000000) / 1000000,
+			Effect: input.Effect,
+		}
+	}
+	return
+}
+
+func presentSensitivity(sensitivity PlanSensitivity) *UpdateAppSensitivity {
+	s := &UpdateAppSensitivity{
+		Prices:        presentInputs(sensitivity.Prices, 100),
+		SerialHours:   presentInputs(sensitivity.SerialSeconds, 3600),
+		ParallelHours: presentInputs(sensitivity.ParallelSeconds, 3600),
+		BreakEven:     make([]BreakEven, len(sensitivity.BreakEven)),
+	}
+	for i, b := range sensitivity.BreakEven {
+		s.BreakEven[i] = BreakEven{
+			Name:         b.Name,
+			Per:          FormatQuantity(b.Per),
+			Price:        toDollars(b.PriceCents),
+			ScratchPrice: toDollars(b.ScratchPriceCents),
+			Made:         b.Made,
+			MakeCheaper:  b.MakeCheaper,
+		}
+	}
+	return s
+}
@@ -1,24 +1,21 @@
 package recipe
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"os/exec"
-	"path"
-	"sort"
+	"math"
 	"strings"
 	"time"
 
-	"github.com/BurntSushi/toml"
 	log "github.com/cihub/seelog"
 )
 
 type Reactions struct {
-	Reactions []Reaction `toml:"reaction"`
+	Reactions     []Reaction     `toml:"reaction"`
+	Substitutions []Substitution `toml:"substitution"`
 }
 
 // Reaction is the reaction that takes place, with reactants
@@ -36,6 +33,13 @@ type Reaction struct {
 	// proportional to the quantities.
 	SerialHours float64 `toml:"s_hours" json:"s_hours,omitempty"`
 
+	// The min and max hours are optional ranges of the hours, which are
+	// used to estimate how long a plan could take.
+	ParallelHoursMin float64 `toml:"p_hours_min" json:"p_hours_min,omitempty"`
+	ParallelHoursMax float64 `toml:"p_hours_max" json:"p_hours_max,omitempty"`
+	SerialHoursMin   float64 `toml:"s_hours_min" json:"s_hours_min,omitempty"`
+	SerialHoursMax   float64 `toml:"s_hours_max" json:"s_hours_max,omitempty"`
+
 	Directions string    `toml:"directions" json:"directions,omitempty"`
 	Notes      string    `toml:"notes" json:"notes,omitempty"`
 	Product    []Element `toml:"product" json:"product,omitempty"`
@@ -44,6 +48,35 @@ type Reaction struct {
 	// LastUpdated is the year it was last updated
 	// (refers to the price)
 	LastUpdated time.Time `toml:"updated" json:"updated,omitempty"`
+
+	// Footprint is the environmental footprint of the reaction itself, like
+	// the energy for baking, for the amounts of the products. It scales
+	// with the quantities.
+	Footprint *Footprint `toml:"footprint" json:"footprint,omitempty"`
+
+	// Published reactions are listed as recipes (see Recipes), the
+	// Featured ones first. Title, Description, Image and Category describe
+	// the recipe on its page.
+	Published   bool   `toml:"published" json:"published,omitempty"`
+	Featured    bool   `toml:"featured" json:"featured,omitempty"`
+	Title       string `toml:"title" json:"title,omitempty"`
+	Description string `toml:"description" json:"description,omitempty"`
+	Image       string `toml:"image" json:"image,omitempty"`
+	Category    string `toml:"category" json:"category,omitempty"`
+
+	// Season is when the reaction can start, for agricultural reactions
+	Season *Season `toml:"season" json:"season,omitempty"`
+
+	// alternatives are the other reactions with the same product, the
+	// first one in the toml being the one that is used by default
+	alternatives []Reaction
+
+	// substitutions are the substitutions made to the reactants
+	substitutions []UpdateAppSubstitution
+
+	// excluded is set when every way to make the product is excluded by
+	// the diet, so it can only be bought
+	excluded bool
 }
 
 type Element struct {
@@ -61,8 +94,38 @@ type Element struct {
 	// Price is the cost per amount+measure, specified on products.
 	Price float64 `toml:"price" json:"price,omitempty"`
 
+	// PriceMin and PriceMax are the optional range of the price, which
+	// are used to estimate how much a plan could cost.
+	PriceMin float64 `toml:"price_min" json:"price_min,omitempty"`
+	PriceMax float64 `toml:"price_max" json:"price_max,omitempty"`
+
 	// Notes are for references
 	Notes string `toml:"notes" json:"notes,omitempty"`
+
+	// Nutrition is the nutrition in the amount+measure, specified on
+	// products. It is optional.
+	Nutrition *Nutrition `toml:"nutrition" json:"nutrition,omitempty"`
+
+	// Servings is the number of servings in the amount+measure, specified
+	// on products, and ServingSize describes one serving, e.g. "1 slice".
+	Servings    float64 `toml:"servings" json:"servings,omitempty"`
+	ServingSize string  `toml:"serving_size" json:"serving_size,omitempty"`
+
+	// FoodDataID is the fdc_id of the matching USDA FoodData Central food
+	// and Grams is the weight of the amount+measure, so that nutrition can
+	// be imported from a FoodData Central CSV (see LoadFoodDataCentral).
+	FoodDataID int     `toml:"fdc_id" json:"fdc_id,omitempty"`
+	Grams      float64 `toml:"grams" json:"grams,omitempty"`
+
+	// Tags are the allergens and dietary flags of the product, e.g.
+	// "gluten", "dairy", "egg", "nut", "pork" or "animal-derived", which it
+	// has whether it is bought or made. If a product has no tags (and not
+	// an empty list), buying it has the tags of the reactants that make it.
+	Tags []string `toml:"tags" json:"tags,omitempty"`
+
+	// Footprint is the environmental footprint of buying the
+	// amount+measure, specified on products. It is optional.
+	Footprint *Footprint `toml:"footprint" json:"footprint,omitempty"`
 }
 
 // Dag is the format that the reactions are parsed into. Each root only
@@ -77,33 +140,76 @@ type Dag struct {
 	Product       Element   `toml:"product" json:"product,omitempty"`
 	Reactant      []Element `toml:"reactant" json:"reactant,omitempty"`
 	Children      []*Dag
+
+	// Reason is why the product is made or bought (see the Reason
+	// constants), Why explains it and Depth is how far it is from the recipe
+	Reason string `json:"reason,omitempty"`
+	Why    string `json:"why,omitempty"`
+	Depth  int    `json:"depth"`
 }
 
 type UpdateApp struct {
-	MinutesToBuild float64                `json:"minutes"`
-	Graph          string                 `json:"graph"`
-	Version        string                 `json:"version"`
-	Recipe         string                 `json:"recipe"`
-	Amount         float64                `json:"amount"`
-	Measure        string                 `json:"measure"`
-	TotalCost      string                 `json:"totalCost"`
-	TotalTime      string                 `json:"totalTime"`
-	Ingredients    []UpdateAppIngredients `json:"ingredients"`
-	Directions     []UpdateAppDirections  `json:"directions"`
+	MinutesToBuild float64                 `json:"minutes"`
+	Graph          string                  `json:"graph"`
+	Version        string                  `json:"version"`
+	Recipe         string                  `json:"recipe"`
+	Amount         float64                 `json:"amount"`
+	Measure        string                  `json:"measure"`
+	TotalCost      string                  `json:"totalCost"`
+	TotalTime      string                  `json:"totalTime"`
+	Ingredients    []UpdateAppIngredients  `json:"ingredients"`
+	Directions     []UpdateAppDirections   `json:"directions"`
+	Nutrition      *UpdateAppNutrition     `json:"nutrition,omitempty"`
+	Tags           []string                `json:"tags"`
+	Diet           []string                `json:"diet,omitempty"`
+	Substitutions  []UpdateAppSubstitution `json:"substitutions"`
+	Servings       float64                 `json:"servings,omitempty"`
+	ServingSize    string                  `json:"servingSize,omitempty"`
+	CostPerServing string                  `json:"costPerServing,omitempty"`
+	TimePerServing string                  `json:"timePerServing,omitempty"`
+	Footprint      *UpdateAppFootprint     `json:"footprint,omitempty"`
+	Start          string                  `json:"start"`
+	Ready          string                  `json:"ready"`
+	Estimate       *UpdateAppEstimate      `json:"estimate,omitempty"`
+	Sensitivity    *UpdateAppSensitivity   `json:"sensitivity,omitempty"`
 }
 
 type UpdateAppIngredients struct {
-	Amount      string `json:"amount"`
-	Name        string `json:"name"`
-	Cost        string `json:"cost"`
-	ScratchTime string `json:"scratchTime"`
-	ScratchCost string `json:"scratchCost"`
+	Amount      string   `json:"amount"`
+	Name        string   `json:"name"`
+	Cost        string   `json:"cost"`
+	ScratchTime string   `json:"scratchTime"`
+	ScratchCost string   `json:"scratchCost"`
+	Tags        []string `json:"tags"`
+	Reason      string   `json:"reason"`
+	Why         string   `json:"why"`
 }
 
 type UpdateAppDirections struct {
 	Name      string   `json:"name"`
 	TotalTime string   `json:"totalTime"`
 	Texts     []string `json:"texts"`
+	Tags      []string `json:"tags"`
+	Start     string   `json:"start"`
+	Ready     string   `json:"ready"`
+	Reason    string   `json:"reason"`
+	Why       string   `json:"why"`
+}
+
+// UpdateAppNutrition is the nutrition of the plan. StoreBought is the
+// nutrition of buying the recipe and Scratch is the nutrition of making
+// it from its ingredients, when either is known.
+type UpdateAppNutrition struct {
+	Servings    float64    `json:"servings"`
+	Total       Nutrition  `json:"total"`
+	PerServing  Nutrition  `json:"perServing"`
+	StoreBought *Nutrition `json:"storeBought,omitempty"`
+	Scratch     *Nutrition `json:"scratch,omitempty"`
+
+	// Complete is whether everything in the total has nutrition, and
+	// Missing are the ingredients that don't, which the total leaves out
+	Complete bool     `json:"complete"`
+	Missing  []string `json:"missing,omitempty"`
 }
 
 type RequestFromApp struct {
@@ -112,45 +218,145 @@ type RequestFromApp struct {
 	Recipe             string              `json:"recipe"`
 	IngredientsToBuild map[string]struct{} `json:"ingredientsToBuild"`
 	MinutesToBuild     float64             `json:"minutes"`
+
+	// Diet are the diets, like "vegan" or "gluten-free", the plan must
+	// comply with
+	Diet []string `json:"diet"`
+
+	// Unavailable are ingredients that can't be bought, which are
+	// substituted or made instead
+	Unavailable []string `json:"unavailable"`
+
+	// Cheaper substitutes ingredients whenever the substitute is cheaper
+	Cheaper bool `json:"cheaper"`
+
+	// BuyCheaper buys ingredients whenever that is cheaper than making them,
+	// unless they have to be made
+	BuyCheaper bool `json:"buyCheaper"`
+
+	// Servings is the number of servings to make, which is used instead of
+	// the amount if it is set
+	Servings float64 `json:"servings"`
+
+	// Start is the date (YYYY-MM-DD) the plan starts, without which the
+	// plan isn't dated, and Hemisphere is "north" (the default) or "south", which
+	// determine the dates of everything in the plan
+	Start      string `json:"start"`
+	Hemisphere string `json:"hemisphere"`
+
+	// Samples is the number of times to sample the uncertain prices and
+	// times to estimate the range of the cost and time, using the Seed
+	Samples int   `json:"samples"`
+	Seed    int64 `json:"seed"`
+
+	// Sensitivity adds how the total cost and time change with each price
+	// and time, and the break-even prices of making each ingredient
+	Sensitivity bool `json:"sensitivity"`
+
+	// NoGraph skips rendering the graph of the plan, e.g. for exporting it
+	NoGraph bool `json:"-"`
 }
 
 func GetRecipe(recipe string, amountSpecified float64, hours float64, ingredientsToInclude map[string]struct{}) (payload UpdateApp, err error) {
-	payload.Version = "v0.0.0"
-	payload.Recipe = recipe
+	return GetRecipeFromRequest(RequestFromApp{
+		Recipe:             recipe,
+		Amount:             amountSpecified,
+		MinutesToBuild:     hours * 60,
+		IngredientsToBuild: ingredientsToInclude,
+	})
+}
 
-	// collect all the possible reactions
-	var r Reactions
-	b, err := ioutil.ReadFile("recipes.toml")
+// Errors about the request, which are wrapped with the details
+var (
+	ErrUnknownRecipe = errors.New("unknown recipe")
+	ErrInvalidAmount = errors.New("invalid amount")
+	ErrUnitMismatch  = errors.New("unit mismatch")
+)
+
+// ErrUnavailable is the error of an ingredient that is unavailable and
+// can't be substituted or made instead, which is wrapped with its name
+var ErrUnavailable = errors.New("unavailable")
+
+// ErrGraph is the error of a graph that can't be rendered, which is wrapped
+// with why
+var ErrGraph = errors.New("graph can't be rendered")
+
+// checkAmount makes sure an amount in the request is a number that isn't
+// negative
+func checkAmount(name string, amount float64) (err error) {
+	if math.IsNaN(amount) || math.IsInf(amount, 0) || amount < 0 {
+		err = fmt.Errorf("%w: %s can't be %g", ErrInvalidAmount, name, amount)
+	}
+	return
+}
+
+// GetPlan computes the plan for everything in the request
+func GetPlan(request RequestFromApp) (plan Plan, err error) {
+	return GetPlanContext(context.Background(), request)
+}
+
+// GetPlanContext computes the plan for everything in the request, and
+// stops with the error of the context once it is done
+func GetPlanContext(ctx context.Context, request RequestFromApp) (plan Plan, err error) {
+	recipe := request.Recipe
+	amountSpecified := request.Amount
+	hours := request.MinutesToBuild / 60
+	plan.Version = PlanVersion
+	plan.Recipe = recipe
+	plan.Diet = request.Diet
+	for _, amount := range []struct {
+		name  string
+		value float64
+	}{
+		{"amount", request.Amount},
+		{"minutes", request.MinutesToBuild},
+		{"servings", request.Servings},
+	} {
+		if err = checkAmount(amount.name, amount.value); err != nil {
+			return
+		}
+	}
+	start, south, err := parseStart(request.Start, request.Hemisphere)
 	if err != nil {
 		return
 	}
-	_, err = toml.Decode(string(b), &r)
+
+	// collect all the possible reactions
+	reactions, substitutions, err := loadReactions(CatalogFile)
 	if err != nil {
 		return
 	}
-	reactions := make(map[string]Reaction)
-	for _, reaction := range r.Reactions {
-		for _, product := range reaction.Product {
-			if _, ok := reactions[product.Name]; ok {
-				log.Debugf("uh oh, already have %s", product.Name)
-			} else {
-				reactions[product.Name] = Reaction{
-					Directions:    reaction.Directions,
-					LastUpdated:   reaction.LastUpdated,
-					Notes:         reaction.Notes,
-					ParallelHours: reaction.ParallelHours,
-					SerialHours:   reaction.SerialHours,
-					Reactant:      reaction.Reactant,
-					Product: []Element{{
-						Name:    product.Name,
-						Amount:  product.Amount,
-						Measure: product.Measure,
-						Notes:   product.Notes,
-						Price:   product.Price,
-					}},
-				}
+	if _, ok := reactions[recipe]; !ok {
+		err = fmt.Errorf("%w: %s", ErrUnknownRecipe, recipe)
+		return
+	}
 
-			}
+	// substitute what is unavailable or excluded (or more expensive), and
+	// then choose the reactions that fit the diet, which may mean some
+	// ingredients have to be made
+	excluded, err := excludedTags(request.Diet)
+	if err != nil {
+		return
+	}
+	unavailable := make(map[string]struct{})
+	for _, ing := range request.Unavailable {
+		unavailable[ing] = struct{}{}
+	}
+	reactions = applySubstitutions(reactions, substitutions, unavailable, excluded, request.Cheaper)
+	reactions, mustMake, err := applyDiet(reactions, recipe, excluded)
+	if err != nil {
+		return
+	}
+	ingredientsToInclude := make(map[string]struct{})
+	for ing := range request.IngredientsToBuild {
+		ingredientsToInclude[ing] = struct{}{}
+	}
+	for ing := range mustMake {
+		ingredientsToInclude[ing] = struct{}{}
+	}
+	for ing := range unavailable {
+		if len(reactions[ing].Reactant) > 0 {
+			ingredientsToInclude[ing] = struct{}{}
 		}
 	}
 
@@ -159,65 +365,119 @@ func GetRecipe(recipe string, amountSpecified float64, hours float64, ingredient
 	d := new(Dag)
 	recipeToGet := reactions[recipe].Product[0]
 	// log.Debug(reactions[recipe].Product[0])
+	if request.Measure != "" {
+		var ok bool
+		amountSpecified, ok = convertMeasure(amountSpecified, request.Measure, recipeToGet.Measure)
+		if !ok {
+			err = fmt.Errorf("%w: %s is measured in %s, not %s", ErrUnitMismatch, recipe, recipeToGet.Measure, request.Measure)
+			return
+		}
+	}
 	recipeToBuildFrom := Element{
 		Name:    recipeToGet.Name,
 		Amount:  amountSpecified,
 		Measure: recipeToGet.Measure,
 		Price:   recipeToGet.Price,
 	}
+	if request.Servings > 0 {
+		recipeToBuildFrom.Amount, err = amountForServings(recipeToGet, request.Servings)
+		if err != nil {
+			return
+		}
+	}
 	if recipeToBuildFrom.Amount == 0 {
 		recipeToBuildFrom.Amount = recipeToGet.Amount
 	}
 	recursivelyAddRecipe(recipeToBuildFrom, d, reactions)
-	payload.Amount = recipeToBuildFrom.Amount
-	payload.Measure = recipeToBuildFrom.Measure
+	plan.Quantity = canonicalQuantity(recipeToBuildFrom.Amount, recipeToBuildFrom.Measure)
 
+	if request.BuyCheaper {
+		pruneTreeByCost(d, reactions, ingredientsToInclude, 0)
+	}
 	totalTime := pruneTreeByTimeAndIngredients(d, 0, hours, ingredientsToInclude)
+	explainDag(d, 0, reactions, request.IngredientsToBuild, mustMake, unavailable)
+	nodes := shallowestNodes(d)
 	// log.Info("totalTime", totalTime, FormatDuration(totalTime))
-	payload.TotalTime = FormatDuration(totalTime)
-	payload.MinutesToBuild = totalTime * 60
-	if payload.TotalTime == "" {
-		payload.TotalTime = "No time"
-	}
+	plan.Seconds = toSeconds(totalTime)
 
 	// get graphviz for full graph
-	payload.Graph, err = getGraphviz(d)
-	if err != nil {
-		log.Error(err)
+	if err = ctx.Err(); err != nil {
 		return
 	}
+	if !request.NoGraph {
+		plan.Graph, err = getGraphviz(ctx, d)
+		if err != nil {
+			log.Error(err)
+			if ctx.Err() == nil {
+				err = fmt.Errorf("%w: %s", ErrGraph, err)
+			}
+			return
+		}
+	}
 
 	// parse tree for ingredients to build and the ingredients to buy
 	ingredientsToBuild, ingredientsToBuy := getIngredientsToBuild(d, []Element{}, []Element{})
+	for _, ing := range ingredientsToBuy {
+		if _, ok := unavailable[ing.Name]; ok {
+			err = fmt.Errorf("%w: %s can't be substituted or made", ErrUnavailable, ing.Name)
+			return
+		}
+	}
 	// log.Debug("\nIngredients to build:")
 	// for _, ing := range ingredientsToBuild {
 	// 	log.Debug("-", ing.Name, ing.Amount)
 	// }
 	// log.Debug("\nIngredients to buy:")
-	payload.Ingredients = make([]UpdateAppIngredients, len(ingredientsToBuy))
+	plan.Ingredients = make([]PlanIngredient, len(ingredientsToBuy))
 	totalCost := 0.0
 	for i, ing := range ingredientsToBuy {
 		// log.Debug("ingredientsToBuy", ing.Name, ing.Amount, ing.Price)
 		totalCost += ing.Price
-		payload.Ingredients[i].Name = ing.Name
-		payload.Ingredients[i].Amount = FormatMeasure(ing.Amount, ing.Measure)
-		payload.Ingredients[i].Cost = fmt.Sprintf("$%2.2f", ing.Price)
+		plan.Ingredients[i].Name = ing.Name
+		plan.Ingredients[i].Quantity = canonicalQuantity(ing.Amount, ing.Measure)
+		plan.Ingredients[i].CostCents = toCents(ing.Price)
+		plan.Ingredients[i].Tags = sortedTags(productTags(reactions, ing.Name, 0))
+		plan.Ingredients[i].Reason = nodes[ing.Name].Reason
+		plan.Ingredients[i].Why = nodes[ing.Name].Why
+		if reaction, ok := reactions[ing.Name]; ok {
+			plan.Ingredients[i].Notes = strings.TrimSpace(reaction.Product[0].Notes)
+		}
 		priceDifference, timeDifference, errScratch := scratchReplacement(reactions, ing.Name, ing.Amount)
 		if errScratch != nil {
 			log.Warn(errScratch)
 			continue
 		}
-		log.Info(ing.Name, priceDifference, timeDifference)
-		payload.Ingredients[i].ScratchCost = FormatCost(priceDifference)
-		payload.Ingredients[i].ScratchTime = FormatDuration(timeDifference)
+		plan.Ingredients[i].Scratch = &PlanScratch{
+			CostDifferenceCents: toCents(priceDifference),
+			Seconds:             toSeconds(timeDifference),
+		}
 	}
 	// log.Debug("totalCost", totalCost)
-	payload.TotalCost = FormatCost(totalCost)
-	if len(payload.TotalCost) > 1 {
-		payload.TotalCost = payload.TotalCost[1:]
-	} else {
-		payload.TotalCost = "$0"
+	plan.CostCents = toCents(totalCost)
+
+	setServings(&plan, recipeToGet, recipeToBuildFrom.Amount, totalCost, totalTime)
+	plan.Nutrition = getPlanNutrition(d, reactions)
+	plan.Footprint = getPlanFootprint(d, reactions)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	plan.Estimate = estimatePlan(d, reactions, request.Samples, request.Seed)
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if request.Sensitivity {
+		plan.Sensitivity = planSensitivity(d, reactions)
+	}
+	// plans are only dated when they have a start, so that the same
+	// request is always the same plan
+	schedule := make(map[string]window)
+	if !start.IsZero() {
+		plan.Start = start.Format(dateFormat)
+		plan.Ready = scheduleDag(d, start, south, reactions, schedule).Format(dateFormat)
 	}
+	plan.Tags = sortedTags(planTags(d, reactions))
+	plan.Substitutions = planSubstitutions(d, reactions)
+	plan.Nodes, _ = planNodes(d, 0, []PlanNode{})
 
 	// collect the roots
 	// log.Debug("collect the roots")
@@ -289,17 +549,24 @@ func GetRecipe(recipe string, amountSpecified float64, hours float64, ingredient
 	}
 	// log.Debug(directionsOrder)
 	// log.Debug(printDag(d))
-	payload.Directions = make([]UpdateAppDirections, len(directionsOrder))
+	plan.Steps = make([]PlanStep, len(directionsOrder))
 	for i, direction := range directionsOrder {
-		payload.Directions[i].Name = direction
-		payload.Directions[i].TotalTime = FormatDuration(rootMap[direction].SerialHours + rootMap[direction].ParallelHours)
-		payload.Directions[i].Texts = []string{}
+		plan.Steps[i].Name = direction
+		plan.Steps[i].Seconds = toSeconds(rootMap[direction].SerialHours + rootMap[direction].ParallelHours)
+		plan.Steps[i].Tags = sortedTags(planTags(rootMap[direction], reactions))
+		if w, ok := schedule[direction]; ok {
+			plan.Steps[i].Start = w.start.Format(dateFormat)
+			plan.Steps[i].Ready = w.ready.Format(dateFormat)
+		}
+		plan.Steps[i].Reason = nodes[direction].Reason
+		plan.Steps[i].Why = nodes[direction].Why
+		plan.Steps[i].Texts = []string{}
 		for _, text := range strings.Split(rootMap[direction].Directions, "\n") {
 			text = strings.TrimSpace(text)
 			if len(text) == 0 {
 				continue
 			}
-			payload.Directions[i].Texts = append(payload.Directions[i].Texts, text)
+			plan.Steps[i].Texts = append(plan.Steps[i].Texts, text)
 		}
 	}
 
@@ -308,6 +575,42 @@ func GetRecipe(recipe string, amountSpecified float64, hours float64, ingredient
 	return
 }
 
+// loadReactions reads the toml catalog and indexes every reaction by each
+// of its products, so that a reaction with several products (e.g. butter
+// and buttermilk) can be found by either name. It also returns the
+// substitutions in the catalog.
+func loadReactions(fname string) (reactions map[string]Reaction, substitutions []Substitution, err error) {
+	r, err := LoadCatalog(fname)
+	if err != nil {
+		return
+	}
+	reactions = indexReactions(r)
+	substitutions = r.Substitutions
+	return
+}
+
+func indexReactions(r Reactions) (reactions map[string]Reaction) {
+	reactions = make(map[string]Reaction)
+	for _, reaction := range r.Reactions {
+		for _, product := range reaction.Product {
+			// the reaction for just this product
+			productReaction := reaction
+			productReaction.Product = []Element{product}
+			if primary, ok := reactions[product.Name]; ok {
+				// another way of making the same product, which
+				// can be chosen to satisfy a diet
+				log.Debugf("alternative reaction for %s", product.Name)
+				primary.alternatives = append(primary.alternatives, productReaction)
+				reactions[product.Name] = primary
+			} else {
+				reactions[product.Name] = productReaction
+			}
+		}
+	}
+	applyFoodDataCentral(reactions)
+	return
+}
+
 func scratchReplacement(reactions map[string]Reaction, ing string, amount float64) (priceDifference float64, timeDifference float64, err error) {
 	if _, ok := reactions[ing]; !ok {
 		err = errors.New("no such reaction for " + ing)
@@ -388,28 +691,8 @@ func pruneTreeByTime(d *Dag, currentTime float64, maxTime float64) {
 }
 
 func printDag(d *Dag) string {
-	return printDagRecursively(d, 0)
-}
-
-func printDagRecursively(d *Dag, in int) string {
-	s := ""
-	for i := 0; i < in; i++ {
-		s += "---"
-	}
-	s += fmt.Sprintf("%s %2.3f %s\n", d.Product.Name, d.Product.Amount, d.Product.Measure)
-	for _, child := range d.Children {
-		s += printDagRecursively(child, in+1)
-	}
-	return s
-}
-
-func generateDagGraphviz(d *Dag, dots map[string]struct{}) map[string]struct{} {
-	dots[fmt.Sprintf(`"%s" [color="white", fontcolor="white"];`, d.Product.Name)] = struct{}{}
-	for _, child := range d.Children {
-		dots[fmt.Sprintf(`"%s" -> "%s" [style="filled", color="white"];`, child.Product.Name, d.Product.Name)] = struct{}{}
-		dots = generateDagGraphviz(child, dots)
-	}
-	return dots
+	nodes, _ := planNodes(d, 0, []PlanNode{})
+	return printTree(nodes)
 }
 
 func pathExists(fromNode *Dag, toNode *Dag) bool {
@@ -556,49 +839,6 @@ func SetLogLevel(level string) (err error) {
 	return
 }
 
-func getGraphviz(d *Dag) (graphvizFileName string, err error) {
-	dotsMap := generateDagGraphviz(d, make(map[string]struct{}))
-	dots := make([]string, len(dotsMap))
-	i := 0
-	for key := range dotsMap {
-		dots[i] = key
-		i++
-	}
-	sort.Strings(dots)
-	// log.Info(dots)
-	graphvizData := fmt.Sprintf(`digraph G {
-color="#FFFFFF"
-bgcolor="#357EDD00" # RGBA (with alpha)
-
-%s
-}`, strings.Join(dots, "\n"))
-	os.MkdirAll("graphviz", 0644)
-	graphvizFileName = path.Join("graphviz", GetMD5Hash(graphvizData)+".png")
-	if _, err = os.Stat(graphvizFileName); err == nil {
-		// log.Infof("already generated %s", graphvizFileName)
-		return
-	}
-	// log.Info(graphvizData, graphvizFileName)
-
-	content := []byte(graphvizData)
-	tmpfile, err := ioutil.TempFile("", "example")
-	if err != nil {
-		return
-	}
-
-	defer os.Remove(tmpfile.Name()) // clean up
-
-	if _, err = tmpfile.Write(content); err != nil {
-		return
-	}
-	if err = tmpfile.Close(); err != nil {
-		return
-	}
-	cmd := exec.Command("dot", "-Tpng", tmpfile.Name(), "-o"+graphvizFileName)
-	_, err = cmd.CombinedOutput()
-	return
-}
-
 func GetMD5Hash(text string) string {
 	hasher := md5.New()
 	hasher.Write([]byte(text))
@@ -1,8 +1,15 @@
 package recipe
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/BurntSushi/toml"
@@ -21,6 +28,14 @@ func TestFormatString(t *testing.T) {
 	assert.Equal(t, "1 ⅝ tablespoons", FormatMeasure(0.1, "cup"))
 }
 
+func TestFormatCookingRational(t *testing.T) {
+	// close enough to the next whole number to round up to it
+	assert.Equal(t, " 1", FormatCookingRational(0.97))
+	assert.Equal(t, " 2", FormatCookingRational(1.97))
+	assert.Equal(t, "1 teaspoon", FormatMeasure(0.97/48, "cup"))
+	assert.Equal(t, "2 cups", FormatMeasure(1.97, "cup"))
+}
+
 func TestGetRecipe1(t *testing.T) {
 	payload, err := GetRecipe("chocolate chip cookies", 0, 1, make(map[string]struct{}))
 	assert.Nil(t, err)
@@ -83,6 +98,630 @@ func TestPruneByIngredient(t *testing.T) {
 	log.Info(pruneTreeByTimeAndIngredients(d, 0, 100, ingredientsToMake))
 	log.Info(printDag(d))
 
-	getGraphviz(d)
+	getGraphviz(context.Background(), d)
+
+}
+
+func TestReadFoodDataCentral(t *testing.T) {
+	csv := `"id","fdc_id","nutrient_id","amount","data_points"
+"1","168894","1008","364","1"
+"2","168894","1003","10.3","1"
+"3","168894","1004","0.98","1"
+"4","168894","1005","76.3","1"
+"5","168894","1079","2.7","1"
+"6","168894","1093","2","1"
+"7","168894","1162","0","1"
+`
+	foods, err := ReadFoodDataCentral(strings.NewReader(csv))
+	assert.Nil(t, err)
+	assert.Equal(t, Nutrition{Calories: 364, Protein: 10.3, Fat: 0.98, Carbs: 76.3, Fiber: 2.7, Sodium: 2}, foods[168894])
+
+	_, err = ReadFoodDataCentral(strings.NewReader("\"id\",\"amount\"\n"))
+	assert.NotNil(t, err)
+}
+
+func TestPlanNutrition(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+
+	// buying everything is just the store-bought nutrition
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["pancakes"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, make(map[string]struct{}))
+	nutrition := getPlanNutrition(d, reactions)
+	assert.Equal(t, 4.0, nutrition.Servings)
+	assert.Equal(t, 1400.0, nutrition.Total.Calories)
+	assert.Equal(t, 350.0, nutrition.PerServing.Calories)
+	assert.Equal(t, 1400.0, nutrition.StoreBought.Calories)
+
+	// making them is the nutrition of the ingredients
+	d = new(Dag)
+	recursivelyAddRecipe(reactions["pancakes"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, map[string]struct{}{"pancakes": {}})
+	nutrition = getPlanNutrition(d, reactions)
+	assert.Equal(t, *nutrition.Scratch, nutrition.Total)
+	assert.NotEqual(t, nutrition.StoreBought.Calories, nutrition.Total.Calories)
+	assert.True(t, nutrition.Complete)
+	assert.Nil(t, nutrition.Missing)
+
+	// the total of an apple pie leaves out what has no nutrition
+	d = new(Dag)
+	recursivelyAddRecipe(reactions["apple pie"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, map[string]struct{}{"apple pie": {}})
+	nutrition = getPlanNutrition(d, reactions)
+	assert.False(t, nutrition.Complete)
+	assert.Equal(t, []string{"cinnamon", "water"}, nutrition.Missing)
+}
+
+func TestApplyDiet(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"animal-derived", "dairy", "gluten"}, sortedTags(productTags(reactions, "apple pie", 0)))
+
+	// a vegan apple pie has to be made, with the oil crust
+	excluded, err := excludedTags([]string{"vegan"})
+	assert.Nil(t, err)
+	compliant, mustMake, err := applyDiet(reactions, "apple pie", excluded)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{"apple pie": {}, "pie crust": {}}, mustMake)
+	assert.True(t, hasReactant(compliant["pie crust"], "olive oil"))
+	assert.False(t, hasReactant(compliant["pie crust"], "butter"))
+	assert.Equal(t, 1.24, compliant["pie crust"].Product[0].Price)
+
+	d := new(Dag)
+	recursivelyAddRecipe(compliant["apple pie"].Product[0], d, compliant)
+	pruneTreeByTimeAndIngredients(d, 0, 0, mustMake)
+	assert.Equal(t, []string{"gluten"}, sortedTags(planTags(d, compliant)))
+
+	// pancakes need flour, which always has gluten
+	excluded, err = excludedTags([]string{"gluten-free"})
+	assert.Nil(t, err)
+	_, _, err = applyDiet(reactions, "pancakes", excluded)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "flour contains gluten")
+
+	_, err = excludedTags([]string{"paleo"})
+	assert.NotNil(t, err)
+}
+
+// findReactant returns the reactant of the reaction with the name
+func findReactant(reaction Reaction, name string) (e Element, ok bool) {
+	for _, e = range reaction.Reactant {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Element{}, false
+}
+
+func hasReactant(reaction Reaction, name string) bool {
+	_, ok := findReactant(reaction, name)
+	return ok
+}
+
+func TestApplySubstitutions(t *testing.T) {
+	reactions, substitutions, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	index := indexSubstitutions(substitutions)
+	assert.Equal(t, "butter", index["lard"][0].To[0].Name)
+	assert.Equal(t, 1.0, index["lard"][0].To[0].Amount)
+
+	// buttermilk that can't be bought is replaced by milk and vinegar
+	substituted := applySubstitutions(reactions, substitutions, map[string]struct{}{"buttermilk": {}}, nil, false)
+	names := []string{}
+	for _, reactant := range substituted["pancakes"].Reactant {
+		names = append(names, reactant.Name)
+		if reactant.Name == "vinegar" {
+			assert.Equal(t, 0.125, reactant.Amount)
+		}
+	}
+	assert.NotContains(t, names, "buttermilk")
+	assert.Contains(t, names, "vinegar")
+	assert.Equal(t, []UpdateAppSubstitution{{In: "pancakes", From: "buttermilk", To: []string{"milk", "vinegar"}, Reason: SubstitutedUnavailable}}, substituted["pancakes"].substitutions)
+	assert.True(t, strings.HasSuffix(substituted["pancakes"].Directions, "Use milk and vinegar instead of buttermilk."))
+
+	// butter is always dairy, so it is replaced by lard
+	substituted = applySubstitutions(reactions, substitutions, nil, map[string]struct{}{"dairy": {}}, false)
+	lard, ok := findReactant(substituted["pie crust"], "lard")
+	assert.True(t, ok)
+	assert.InDelta(t, 0.528, lard.Amount, 0.0001)
+	assert.False(t, hasReactant(substituted["pie crust"], "butter"))
+}
+
+func TestServings(t *testing.T) {
+	pancakes := Element{Name: "pancakes", Amount: 8, Measure: "whole", Servings: 4, ServingSize: "2 pancakes"}
+	amount, err := amountForServings(pancakes, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, 12.0, amount)
+	assert.Equal(t, 6.0, servingsInAmount(pancakes, 12))
+
+	plan := Plan{}
+	setServings(&plan, pancakes, 12, 3, 1.5)
+	assert.Equal(t, int64(50), plan.CostPerServingCents)
+	assert.Equal(t, int64(900), plan.SecondsPerServing)
+	payload := plan.UpdateApp()
+	assert.Equal(t, "$0.50", payload.CostPerServing)
+	assert.Equal(t, "15 minutes", payload.TimePerServing)
+	assert.Equal(t, "2 pancakes", payload.ServingSize)
+
+	_, err = amountForServings(Element{Name: "salt"}, 2)
+	assert.NotNil(t, err)
+}
+
+func TestPlanFootprint(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+
+	// buying the pancakes is the store-bought footprint
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["pancakes"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, make(map[string]struct{}))
+	footprint := getPlanFootprint(d, reactions)
+	assert.Equal(t, *footprint.StoreBought, footprint.Total)
+
+	// making them includes the energy to cook them
+	d = new(Dag)
+	recursivelyAddRecipe(reactions["pancakes"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, map[string]struct{}{"pancakes": {}})
+	footprint = getPlanFootprint(d, reactions)
+	assert.Equal(t, *footprint.Scratch, footprint.Total)
+	assert.True(t, footprint.Total.Energy > 0.4)
+
+	// land is counted from the soil
+	f, ok := boughtFootprint(reactions, Element{Name: "soil", Amount: 0.5, Measure: "acre"}, 0)
+	assert.True(t, ok)
+	assert.Equal(t, squareMetersPerAcre/2, f.Land)
+}
+
+func TestSchedule(t *testing.T) {
+	start, south, err := parseStart("2026-07-15", "south")
+	assert.Nil(t, err)
+	assert.True(t, south)
+	// corn is planted April to June, which is October to December down south
+	assert.Equal(t, "2026-10-01", nextSeason(start, []int{4, 5, 6}, true).Format(dateFormat))
+	assert.Equal(t, "2027-04-01", nextSeason(start, []int{4, 5, 6}, false).Format(dateFormat))
+	assert.Equal(t, start, nextSeason(start, nil, false))
+
+	_, _, err = parseStart("next week", "")
+	assert.NotNil(t, err)
+	_, _, err = parseStart("", "east")
+	assert.NotNil(t, err)
+
+	reactions := map[string]Reaction{
+		"popcorn": {SerialHours: 1, Product: []Element{{Name: "popcorn", Amount: 1}}, Reactant: []Element{{Name: "corn", Amount: 1}}},
+		"corn":    {ParallelHours: 2400, Season: &Season{Months: []int{4, 5, 6}, HarvestLag: 24}, Product: []Element{{Name: "corn", Amount: 1}}, Reactant: []Element{{Name: "soil", Amount: 1}}},
+	}
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["popcorn"].Product[0], d, reactions)
+	schedule := make(map[string]window)
+	start, _, _ = parseStart("2026-01-10", "north")
+	ready := scheduleDag(d, start, false, reactions, schedule)
+	assert.Equal(t, "2026-04-01", schedule["corn"].start.Format(dateFormat))
+	assert.Equal(t, "2026-07-11", schedule["corn"].ready.Format(dateFormat))
+	assert.Equal(t, schedule["corn"].ready, schedule["popcorn"].start)
+	assert.Equal(t, "2026-07-11", ready.Format(dateFormat))
+
+	// plans are only dated when they have a start
+	CatalogFile = "../recipes.toml"
+	defer func() { CatalogFile = "recipes.toml" }()
+	plan, err := GetPlan(RequestFromApp{Recipe: "pancakes", IngredientsToBuild: map[string]struct{}{"pancakes": {}}, NoGraph: true})
+	assert.Nil(t, err)
+	assert.Equal(t, "", plan.Start)
+	assert.Equal(t, "", plan.Steps[0].Start)
+	plan, err = GetPlan(RequestFromApp{Recipe: "pancakes", IngredientsToBuild: map[string]struct{}{"pancakes": {}}, NoGraph: true, Start: "2026-01-10"})
+	assert.Nil(t, err)
+	assert.Equal(t, "2026-01-10", plan.Start)
+	assert.Equal(t, "2026-01-10", plan.Steps[0].Start)
+}
+
+func TestEstimatePlan(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["pancakes"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 1, map[string]struct{}{"pancakes": {}})
+
+	// the same seed gives the same estimate
+	estimate := estimatePlan(d, reactions, 2000, 42)
+	assert.Equal(t, estimate, estimatePlan(d, reactions, 2000, 42))
+	assert.True(t, estimate.CostCents.P10 <= estimate.CostCents.Median)
+	assert.True(t, estimate.CostCents.Median <= estimate.CostCents.P90)
+	assert.True(t, estimate.Seconds.P10 < estimate.Seconds.P90)
+	assert.True(t, estimate.Seconds.P10 >= 1080)
+	assert.True(t, estimate.Seconds.P90 <= 2160)
+
+	// without ranges there is no uncertainty
+	cost, hours := sampleDag(d, factors{})
+	assert.InDelta(t, cost*100, estimate.CostCents.Median, cost*20)
+	assert.Equal(t, 0.4, hours)
+	assert.Nil(t, estimatePlan(d, reactions, 0, 42))
+
+	// no more than the most samples are taken
+	MaxSamples = 100
+	defer func() { MaxSamples = 100000 }()
+	assert.Equal(t, 100, estimatePlan(d, reactions, 2000, 42).Samples)
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		v := triangular(r, 1, 2, 4)
+		assert.True(t, v >= 1 && v <= 4)
+	}
+	assert.Equal(t, 2.0, triangular(r, 2, 2, 2))
+}
+
+func TestPlanSensitivity(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["apple pie"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 10, map[string]struct{}{})
+	sensitivity := planSensitivity(d, reactions)
+
+	// the total cost (in cents) changes by the amount bought for each price
+	cost, _ := sampleDag(d, factors{})
+	total := 0.0
+	for i, s := range sensitivity.Prices {
+		total += s.Effect * s.Value
+		if i > 0 {
+			assert.True(t, s.Effect <= sensitivity.Prices[i-1].Effect)
+		}
+	}
+	assert.InDelta(t, cost*100, total, 1)
+	assert.Equal(t, "apple pie", sensitivity.SerialSeconds[0].Name)
+	assert.Equal(t, 1.0, sensitivity.SerialSeconds[0].Effect)
+
+	// making is cheaper when the price is above the break-even price
+	for _, b := range sensitivity.BreakEven {
+		assert.Equal(t, b.PriceCents > b.ScratchPriceCents, b.MakeCheaper)
+		if b.Name == "apple pie" {
+			assert.True(t, b.Made)
+		}
+	}
+}
+
+func TestExplainDag(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["apple pie"].Product[0], d, reactions)
+	requested := map[string]struct{}{"pie crust": {}}
+	pruneTreeByTimeAndIngredients(d, 0, 2, requested)
+	explainDag(d, 0, reactions, requested, map[string]struct{}{}, map[string]struct{}{})
+	nodes := shallowestNodes(d)
+	assert.Equal(t, ReasonWithinTime, nodes["apple pie"].Reason)
+	assert.Equal(t, ReasonRequested, nodes["pie crust"].Reason)
+	assert.Equal(t, ReasonNoReaction, nodes["cinnamon"].Reason)
+	assert.Equal(t, ReasonExceededTime, nodes["apple"].Reason)
+	assert.Equal(t, 1, nodes["apple"].Depth)
+	assert.Equal(t, "bought because making it exceeds the time budget at depth 1", nodes["apple"].Why)
+
+	// buying is cheaper for some things, which is only the reason when the
+	// cost decides
+	requested = map[string]struct{}{"apple pie": {}}
+	d = new(Dag)
+	recursivelyAddRecipe(reactions["apple pie"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, requested)
+	explainDag(d, 0, reactions, requested, map[string]struct{}{}, map[string]struct{}{})
+	nodes = shallowestNodes(d)
+	assert.True(t, cheaperToBuy(reactions, nodes["pie crust"].Product))
+	assert.Equal(t, ReasonExceededTime, nodes["pie crust"].Reason)
+	assert.Equal(t, "bought because making it exceeds the time budget at depth 1 (it is also cheaper to buy)", nodes["pie crust"].Why)
+	assert.False(t, cheaperToBuy(reactions, nodes["apple"].Product))
+	assert.Equal(t, ReasonExceededTime, nodes["apple"].Reason)
+	assert.Equal(t, "bought because making it exceeds the time budget at depth 1", nodes["apple"].Why)
+
+	d = new(Dag)
+	recursivelyAddRecipe(reactions["apple pie"].Product[0], d, reactions)
+	pruneTreeByCost(d, reactions, map[string]struct{}{}, 0)
+	pruneTreeByTimeAndIngredients(d, 0, 1000000, map[string]struct{}{})
+	explainDag(d, 0, reactions, map[string]struct{}{}, map[string]struct{}{}, map[string]struct{}{})
+	nodes = shallowestNodes(d)
+	assert.Equal(t, ReasonCheaper, nodes["pie crust"].Reason)
+	assert.Equal(t, "bought because it is cheaper to buy than to make", nodes["pie crust"].Why)
+	assert.Equal(t, 0, len(nodes["pie crust"].Children))
+	assert.Equal(t, ReasonWithinTime, nodes["apple pie"].Reason)
+
+	// the diet can exclude making things
+	excluded, _ := excludedTags([]string{"vegan"})
+	compliant, mustMake, err := applyDiet(reactions, "apple pie", excluded)
+	assert.Nil(t, err)
+	d = new(Dag)
+	recursivelyAddRecipe(compliant["apple pie"].Product[0], d, compliant)
+	pruneTreeByTimeAndIngredients(d, 0, 0, mustMake)
+	explainDag(d, 0, compliant, map[string]struct{}{}, mustMake, map[string]struct{}{})
+	assert.Equal(t, ReasonExcluded, d.Reason)
+}
+
+func TestPlanNodes(t *testing.T) {
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	d := new(Dag)
+	recursivelyAddRecipe(reactions["pancakes"].Product[0], d, reactions)
+	pruneTreeByTimeAndIngredients(d, 0, 0, map[string]struct{}{"pancakes": {}})
+	nodes, cost := planNodes(d, 0, []PlanNode{})
+	assert.Equal(t, 1, nodes[0].ID)
+	assert.Equal(t, 0, nodes[0].Parent)
+	assert.True(t, nodes[0].Made)
+	assert.Equal(t, len(d.Children), len(nodes[0].Children))
+	assert.Equal(t, len(nodes), len(getDagRoots(d, []*Dag{})))
+	for _, node := range nodes[1:] {
+		assert.Equal(t, 1, node.Parent)
+		assert.Contains(t, nodes[0].Children, node.ID)
+		assert.False(t, node.Made)
+	}
+	assert.Equal(t, toCents(cost), nodes[0].CostCents)
+
+	q := canonicalQuantity(2, "tablespoon")
+	assert.Equal(t, "ml", q.Unit)
+	assert.InDelta(t, 29.57, q.Value, 0.01)
+	amount, measure := q.measure()
+	assert.InDelta(t, 0.125, amount, 0.0001)
+	assert.Equal(t, "cup", measure)
+	assert.Equal(t, Quantity{Value: 3, Unit: "whole"}, canonicalQuantity(3, "whole"))
+	assert.Equal(t, "No time", formatTime(0))
+}
+
+func TestRequestErrors(t *testing.T) {
+	_, err := GetPlan(RequestFromApp{Recipe: "pancakes", Amount: -1})
+	assert.True(t, errors.Is(err, ErrInvalidAmount))
+	_, err = GetPlan(RequestFromApp{Recipe: "pancakes", Servings: math.NaN()})
+	assert.True(t, errors.Is(err, ErrInvalidAmount))
+	assert.Nil(t, checkAmount("minutes", 0))
+}
+
+func TestGetPlanCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := getGraphviz(ctx, &Dag{Product: Element{Name: "cancelled"}})
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestLoadRecipes(t *testing.T) {
+	recipes, err := loadRecipes("../recipes.toml")
+	assert.Nil(t, err)
+	assert.Equal(t, 11, len(recipes))
+	assert.True(t, recipes[0].Featured)
+	assert.False(t, recipes[len(recipes)-1].Featured)
+	for _, r := range recipes {
+		if r.Name == "pancakes" {
+			assert.Equal(t, "Pancakes", r.Title)
+			assert.Equal(t, "breakfast", r.Category)
+		}
+	}
+
+	CatalogFile = "../recipes.toml"
+	defer func() { CatalogFile = "recipes.toml" }()
+	recipe, err := PublishedRecipe("apple pie")
+	assert.Nil(t, err)
+	assert.Equal(t, "Apple Pie", recipe.Title)
+	_, err = PublishedRecipe("salt")
+	assert.True(t, errors.Is(err, ErrUnknownRecipe))
+}
+
+func TestSearch(t *testing.T) {
+	assert.Equal(t, 1, editDistance("choclate", "chocolate"))
+	assert.Equal(t, 1, editDistance("mlik", "milk"))
+	assert.Equal(t, 2, editDistance("vanila", "vanillla"))
+
+	reactions, _, err := loadReactions("../recipes.toml")
+	assert.Nil(t, err)
+	recipes, err := loadRecipes("../recipes.toml")
+	assert.Nil(t, err)
+	index := newSearchIndex(reactions, recipes)
+
+	// autocomplete
+	results := index.search("panc", 5)
+	assert.True(t, len(results) > 0)
+	assert.Equal(t, "pancakes", results[0].Name)
+	assert.True(t, results[0].Published)
+	assert.Equal(t, "name", results[0].Fields[0])
+
+	// typos
+	results = index.search("chocolate chip cookeis", 5)
+	assert.True(t, len(results) > 0)
+	assert.Equal(t, "chocolate chip cookies", results[0].Name)
+
+	// every word has to match
+	results = index.search("vanilla ice", 0)
+	assert.True(t, len(results) > 0)
+	assert.Equal(t, "vanilla ice cream", results[0].Name)
+	assert.Equal(t, 0, len(index.search("vanilla zzzzzz", 0)))
+	assert.Equal(t, 0, len(index.search("", 0)))
+
+	CatalogFile = "../recipes.toml"
+	defer func() { CatalogFile = "recipes.toml" }()
+	results, err = Search("yog", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, "yogurt", results[0].Name)
+}
+
+func TestGenerateDOT(t *testing.T) {
+	d := &Dag{
+		Product: Element{Name: "toast", Amount: 1, Measure: "whole"},
+		Children: []*Dag{
+			{
+				Product: Element{Name: "bread", Amount: 1, Measure: "whole"},
+				Children: []*Dag{
+					{Product: Element{Name: "flour", Amount: 2, Measure: "cup"}},
+					{Product: Element{Name: "water", Amount: 0.5, Measure: "cup"}},
+				},
+			},
+			{Product: Element{Name: "butter", Amount: 1, Measure: "tablespoon"}},
+		},
+	}
+	g := NewGraph(d)
+	assert.Equal(t, 5, len(g.Nodes))
+	assert.Equal(t, 4, len(g.Edges))
+	assert.Equal(t, "flour", g.Nodes[2].Name)
+	assert.Equal(t, 2, g.Nodes[2].Rank)
+	assert.Equal(t, "bread", g.Nodes[2].Cluster)
+
+	dot := GenerateDOT(d)
+	assert.True(t, strings.Contains(dot, `"toast" [shape=box, style="rounded,bold"];`))
+	assert.True(t, strings.Contains(dot, `  "flour" [shape=ellipse, style="dashed"];`))
+	assert.True(t, strings.Contains(dot, `subgraph cluster_1 {`))
+	assert.True(t, strings.Contains(dot, `"flour" -> "bread" [label="2 cups"];`))
+	assert.Equal(t, dot, GenerateDOT(d))
+
+	var svg strings.Builder
+	assert.Nil(t, SVGRenderer{}.Render(context.Background(), g, &svg))
+	assert.True(t, strings.HasPrefix(svg.String(), "<svg"))
+	assert.Equal(t, 4, strings.Count(svg.String(), "marker-end"))
+	assert.True(t, strings.Contains(svg.String(), ">2 cups</text>"))
+
+	_, err := NewRenderer("pdf")
+	assert.NotNil(t, err)
+
+	// exports
+	var mermaid strings.Builder
+	assert.Nil(t, ExportGraph(context.Background(), g, "mermaid", Themes["light"], &mermaid))
+	assert.True(t, strings.HasPrefix(mermaid.String(), "flowchart TB\n"))
+	assert.True(t, strings.Contains(mermaid.String(), `n3(["flour"]):::bought`))
+	assert.True(t, strings.Contains(mermaid.String(), `n3 -->|"2 cups"| n2`))
+	assert.True(t, strings.Contains(g.DOT(Themes["light"]), `fillcolor="#E8F0FB"`))
+	jg := g.JSONGraph()
+	assert.Equal(t, "toast", jg.Graph.Label)
+	assert.Equal(t, 5, len(jg.Graph.Nodes))
+	assert.Equal(t, "2 cups", jg.Graph.Edges[1].Label)
+	assert.Equal(t, "ml", jg.Graph.Edges[1].Metadata.Unit)
+	assert.NotNil(t, ExportGraph(context.Background(), g, "gif", Theme{}, &mermaid))
+	_, err = GetTheme("neon")
+	assert.NotNil(t, err)
+
+	// names are escaped, and amounts in each unit are added up on their own
+	g = graphFromNodes([]PlanNode{
+		{ID: 1, Name: `toast "\ jam`, Made: true},
+		{ID: 2, Parent: 1, Name: "egg", Quantity: Quantity{Value: 10, Unit: "ml"}},
+		{ID: 3, Parent: 1, Name: "egg", Quantity: Quantity{Value: 1, Unit: "whole"}},
+		{ID: 4, Parent: 1, Name: "egg", Quantity: Quantity{Value: 5, Unit: "ml"}},
+		{ID: 5, Parent: 1, Name: "line\nbreak", Quantity: Quantity{Value: 1, Unit: "whole"}},
+	})
+	assert.Equal(t, []GraphEdge{
+		{From: "egg", To: `toast "\ jam`, Quantity: Quantity{Value: 15, Unit: "ml"}},
+		{From: "egg", To: `toast "\ jam`, Quantity: Quantity{Value: 1, Unit: "whole"}},
+		{From: "line\nbreak", To: `toast "\ jam`, Quantity: Quantity{Value: 1, Unit: "whole"}},
+	}, g.Edges)
+	dot = g.DOT(Theme{})
+	assert.True(t, strings.Contains(dot, `"toast \"\\ jam" [shape=box`), dot)
+	assert.True(t, strings.Contains(dot, `"line\nbreak" -> "toast \"\\ jam"`), dot)
+}
+
+func TestPlanTree(t *testing.T) {
+	d := &Dag{
+		Product:     Element{Name: "toast", Amount: 1, Measure: "whole"},
+		SerialHours: 0.25,
+		Children: []*Dag{
+			{
+				Product:     Element{Name: "bread", Amount: 1, Measure: "whole"},
+				SerialHours: 3,
+				Children: []*Dag{
+					{Product: Element{Name: "flour", Amount: 2, Measure: "cup", Price: 0.5}},
+				},
+			},
+			{Product: Element{Name: "butter", Amount: 0.5, Measure: "cup", Price: 0.1}},
+		},
+	}
+	assert.Equal(t, `toast, 1 whole (make, 15 minutes)
+|-- bread, 1 whole (make, 3 hours)
+|   `+"`"+`-- flour, 2 cups (buy, $0.50)
+`+"`"+`-- butter, ½ cup (buy, $0.10)
+`, printDag(d))
+}
+
+func TestParseNotes(t *testing.T) {
+	lines := ParseNotes(`
+[$2.48 for two pie crusts](https://www.walmart.com/ip/10813695)
+about 3.333 cups http://www.myrecipes.com/cups-in-pound-of-flour
+prices range
+`)
+	assert.Equal(t, [][]NoteLink{
+		{{Text: "$2.48 for two pie crusts", URL: "https://www.walmart.com/ip/10813695"}},
+		{{Text: "about 3.333 cups "}, {Text: "http://www.myrecipes.com/cups-in-pound-of-flour", URL: "http://www.myrecipes.com/cups-in-pound-of-flour"}},
+		{{Text: "prices range"}},
+	}, lines)
+	assert.Equal(t, 0, len(ParseNotes("")))
+}
+
+func TestWriteCatalog(t *testing.T) {
+	var r Reactions
+	b, _ := ioutil.ReadFile("../recipes.toml")
+	_, err := toml.Decode(string(b), &r)
+	assert.Nil(t, err)
+
+	var written strings.Builder
+	assert.Nil(t, WriteCatalog(&written, r))
+	var r2 Reactions
+	_, err = toml.Decode(written.String(), &r2)
+	assert.Nil(t, err)
+	assert.Equal(t, r, r2)
+	assert.True(t, strings.HasPrefix(written.String(), "[[reaction]]\npublished = true\nfeatured = true\ntitle = \"Apple Pie\"\n"))
+	assert.True(t, strings.Contains(written.String(), "\n\t[[reaction.product]]\n\t\tname=\"apple pie\"\n\t\tamount = 1.0\n\t\tmeasure = \"whole\"\n"))
+}
+
+func TestLoadCatalogDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(fname, s string) {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, fname)), 0755))
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, fname), []byte(s), 0644))
+	}
+
+	// the whole catalog split into a file for each category is the same
+	// catalog
+	r, err := LoadCatalog("../recipes.toml")
+	assert.Nil(t, err)
+	categories := make(map[string][]Reaction)
+	for _, reaction := range r.Reactions {
+		categories[reaction.Category] = append(categories[reaction.Category], reaction)
+	}
+	assert.True(t, len(categories) > 1)
+	for category, reactions := range categories {
+		var b strings.Builder
+		assert.Nil(t, WriteCatalog(&b, Reactions{Reactions: reactions}))
+		write("public/"+category+"/recipes.toml", b.String())
+	}
+	var b strings.Builder
+	assert.Nil(t, WriteCatalog(&b, Reactions{Substitutions: r.Substitutions}))
+	write("public/substitutions.toml", b.String())
+	write("public/.git/config.toml", "not toml")
+	split, err := LoadCatalog(filepath.Join(dir, "public"))
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, r.Reactions, split.Reactions)
+	assert.Equal(t, r.Substitutions, split.Substitutions)
+
+	// a private catalog makes its own butter over the public one
+	write("private/recipes.toml", `include = ["../public"]
+
+[[reaction]]
+	[[reaction.product]]
+		name="butter"
+		amount = 2.0
+		measure = "cup"
+		price = 1.0
+`)
+	private, err := LoadCatalog(filepath.Join(dir, "private"))
+	assert.Nil(t, err)
+	reactions := indexReactions(private)
+	assert.Equal(t, 2.0, reactions["butter"].Product[0].Amount)
+	assert.Equal(t, 0, len(reactions["butter"].alternatives))
+	assert.Equal(t, "buttermilk", reactions["buttermilk"].Product[0].Name)
+	assert.Equal(t, len(r.Substitutions), len(private.Substitutions))
+
+	// two files can't make the same product
+	write("public/zz/butter.toml", "[[reaction]]\n[[reaction.product]]\nname=\"butter\"\namount = 1.0\nmeasure = \"cup\"\n")
+	_, err = LoadCatalog(filepath.Join(dir, "private"))
+	var conflict *ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.True(t, errors.Is(err, ErrCatalog))
+	assert.Equal(t, "butter", conflict.Conflicts[0].Product)
+	assert.Equal(t, 2, len(conflict.Conflicts[0].Files))
+	assert.Equal(t, filepath.Join(dir, "public/zz/butter.toml"), conflict.Conflicts[0].Files[1])
+	assert.Nil(t, os.Remove(filepath.Join(dir, "public/zz/butter.toml")))
 
+	write("public/include.toml", `include = ["../private"]`)
+	_, err = LoadCatalog(filepath.Join(dir, "private"))
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "includes itself"))
 }
@@ -0,0 +1,284 @@
+package recipe
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is a product of the catalog that matches a search. Fields
+// are where it matched: "name", "tags", "notes" or "directions".
+type SearchResult struct {
+	Name      string   `json:"name"`
+	Title     string   `json:"title"`
+	Published bool     `json:"published"`
+	Score     float64  `json:"score"`
+	Fields    []string `json:"fields"`
+}
+
+// the fields that are indexed, from the most important
+const (
+	fieldName = 1 << iota
+	fieldTags
+	fieldNotes
+	fieldDirections
+)
+
+var searchFields = []struct {
+	mask   uint8
+	name   string
+	weight float64
+}{
+	{fieldName, "name", 8},
+	{fieldTags, "tags", 4},
+	{fieldNotes, "notes", 2},
+	{fieldDirections, "directions", 1},
+}
+
+// how good a match of a term is
+const (
+	matchExact  = 1.0
+	matchPrefix = 0.8
+	matchTypo   = 0.5
+)
+
+type searchDoc struct {
+	name      string
+	title     string
+	published bool
+}
+
+// searchIndex maps every term of the catalog to the products that have it,
+// and in which fields
+type searchIndex struct {
+	docs     []searchDoc
+	postings map[string]map[int]uint8
+	// terms are sorted, to find the terms with a prefix
+	terms []string
+}
+
+// searchTerms splits text into lowercase words
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// newSearchIndex indexes the name, tags, notes and directions of every
+// product
+func newSearchIndex(reactions map[string]Reaction, recipes []RecipeInfo) (index *searchIndex) {
+	index = &searchIndex{postings: make(map[string]map[int]uint8)}
+	titles := make(map[string]string)
+	for _, recipe := range recipes {
+		titles[recipe.Name] = recipe.Title
+	}
+
+	names := make([]string, 0, len(reactions))
+	for name := range reactions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for id, name := range names {
+		reaction := reactions[name]
+		doc := searchDoc{name: name, title: titles[name]}
+		_, doc.published = titles[name]
+		if doc.title == "" {
+			doc.title = strings.Title(name)
+		}
+		index.docs = append(index.docs, doc)
+
+		add := func(text string, field uint8) {
+			for _, term := range searchTerms(text) {
+				if _, ok := index.postings[term]; !ok {
+					index.postings[term] = make(map[int]uint8)
+				}
+				index.postings[term][id] |= field
+			}
+		}
+		add(name, fieldName)
+		add(strings.Join(reaction.Product[0].Tags, " "), fieldTags)
+		add(reaction.Notes+" "+reaction.Product[0].Notes, fieldNotes)
+		add(reaction.Directions, fieldDirections)
+	}
+
+	for term := range index.postings {
+		index.terms = append(index.terms, term)
+	}
+	sort.Strings(index.terms)
+	return
+}
+
+// editDistance is the number of insertions, deletions, substitutions and
+// swaps of adjacent letters that turn a into b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// maxTypos is how many typos a word can have, where short words have none
+func maxTypos(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	}
+	return 2
+}
+
+// matchTerm returns how well every indexed term matches the word of the
+// query. The last word of the query may be unfinished, so it also matches
+// the terms it is a prefix of.
+func (index *searchIndex) matchTerm(word string, prefix bool) (matches map[string]float64) {
+	matches = make(map[string]float64)
+	if _, ok := index.postings[word]; ok {
+		matches[word] = matchExact
+	}
+	if prefix {
+		for i := sort.SearchStrings(index.terms, word); i < len(index.terms) && strings.HasPrefix(index.terms[i], word); i++ {
+			if _, ok := matches[index.terms[i]]; !ok {
+				matches[index.terms[i]] = matchPrefix
+			}
+		}
+	}
+	typos := maxTypos(word)
+	if typos == 0 {
+		return
+	}
+	length := len([]rune(word))
+	for _, term := range index.terms {
+		if _, ok := matches[term]; ok {
+			continue
+		}
+		termLength := len([]rune(term))
+		if termLength < length-typos || termLength > length+typos {
+			continue
+		}
+		if distance := editDistance(word, term); distance <= typos {
+			matches[term] = matchTypo / float64(distance)
+		}
+	}
+	return
+}
+
+// search returns the products that match every word of the query, the best
+// first
+func (index *searchIndex) search(query string, limit int) (results []SearchResult) {
+	results = []SearchResult{}
+	words := searchTerms(query)
+	if len(words) == 0 {
+		return
+	}
+
+	scores := make(map[int]float64)
+	fields := make(map[int]uint8)
+	for i, word := range words {
+		// the best match of the word in each product
+		best := make(map[int]float64)
+		for term, quality := range index.matchTerm(word, i == len(words)-1) {
+			for id, mask := range index.postings[term] {
+				for _, field := range searchFields {
+					if mask&field.mask == 0 {
+						continue
+					}
+					if score := quality * field.weight; score > best[id] {
+						best[id] = score
+					}
+					fields[id] |= field.mask
+					break
+				}
+			}
+		}
+		if i == 0 {
+			scores = best
+			continue
+		}
+		for id := range scores {
+			if score, ok := best[id]; ok {
+				scores[id] += score
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	phrase := strings.Join(words, " ")
+	for id, score := range scores {
+		doc := index.docs[id]
+		if strings.HasPrefix(doc.name, phrase) {
+			// the name starts with what was typed
+			score += searchFields[0].weight
+		}
+		result := SearchResult{
+			Name:      doc.name,
+			Title:     doc.title,
+			Published: doc.published,
+			Score:     math.Round(score*100) / 100,
+			Fields:    []string{},
+		}
+		for _, field := range searchFields {
+			if fields[id]&field.mask != 0 {
+				result.Fields = append(result.Fields, field.name)
+			}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Published != results[j].Published {
+			return results[i].Published
+		}
+		if len(results[i].Name) != len(results[j].Name) {
+			return len(results[i].Name) < len(results[j].Name)
+		}
+		return results[i].Name < results[j].Name
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return
+}
+
+// Search returns up to limit products of the catalog that match the query,
+// the best first. The last word of the query can be unfinished, and longer
+// words can have a typo or two. The index is rebuilt whenever the catalog
+// changes.
+func Search(query string, limit int) (results []SearchResult, err error) {
+	catalog.Lock()
+	defer catalog.Unlock()
+	if err = reloadCatalog(); err != nil {
+		return
+	}
+	results = catalog.index.search(query, limit)
+	return
+}
@@ -0,0 +1,192 @@
+package recipe
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// Sensitivity is how much the total of the plan changes per unit change of
+// one input, e.g. the total cost per dollar change of the price of 1 cup of
+// milk, or the total hours per hour change of the time to make butter.
+type Sensitivity struct {
+	Name   string  `json:"name"`
+	Per    string  `json:"per"`
+	Value  float64 `json:"value"`
+	Effect float64 `json:"effect"`
+}
+
+// BreakEven compares buying an ingredient of the plan with making it from
+// its reactants. Making it is cheaper whenever its price is above the
+// scratch price, which is the break-even price.
+type BreakEven struct {
+	Name         string  `json:"name"`
+	Per          string  `json:"per"`
+	Price        float64 `json:"price"`
+	ScratchPrice float64 `json:"scratchPrice"`
+	Made         bool    `json:"made"`
+	MakeCheaper  bool    `json:"makeCheaper"`
+}
+
+// UpdateAppSensitivity is the sensitivity of the plan. Prices are the
+// dollars of total cost per dollar of the price of each bought ingredient,
+// SerialHours and ParallelHours are the hours of total time per hour of
+// each reaction, and they are ranked from the largest effect.
+type UpdateAppSensitivity struct {
+	Prices        []Sensitivity `json:"prices"`
+	SerialHours   []Sensitivity `json:"serialHours"`
+	ParallelHours []Sensitivity `json:"parallelHours"`
+	BreakEven     []BreakEven   `json:"breakEven"`
+}
+
+// PlanInput is how much the total of the plan changes per unit change of
+// one input, where the value of the input is a price in cents or a time in
+// seconds.
+type PlanInput struct {
+	Name   string   `json:"name"`
+	Per    Quantity `json:"per"`
+	Value  float64  `json:"value"`
+	Effect float64  `json:"effect"`
+}
+
+// PlanBreakEven compares buying an ingredient with making it, in cents
+type PlanBreakEven struct {
+	Name              string   `json:"name"`
+	Per               Quantity `json:"per"`
+	PriceCents        int64    `json:"priceCents"`
+	ScratchPriceCents int64    `json:"scratchPriceCents"`
+	Made              bool     `json:"made"`
+	MakeCheaper       bool     `json:"makeCheaper"`
+}
+
+// PlanSensitivity is the sensitivity of the plan, see UpdateAppSensitivity
+type PlanSensitivity struct {
+	Prices          []PlanInput     `json:"prices"`
+	SerialSeconds   []PlanInput     `json:"serialSeconds"`
+	ParallelSeconds []PlanInput     `json:"parallelSeconds"`
+	BreakEven       []PlanBreakEven `json:"breakEven"`
+}
+
+func roundSensitivity(f float64) float64 {
+	return math.Round(f*10000) / 10000
+}
+
+// rankSensitivities sorts by the largest effect, and then by name
+func rankSensitivities(effects map[string]float64, reactions map[string]Reaction, value func(Reaction) float64) (ranked []PlanInput) {
+	ranked = []PlanInput{}
+	for name, effect := range effects {
+		reaction := reactions[name]
+		ranked = append(ranked, PlanInput{
+			Name:   name,
+			Per:    canonicalQuantity(reaction.Product[0].Amount, reaction.Product[0].Measure),
+			Value:  value(reaction),
+			Effect: roundSensitivity(effect),
+		})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if math.Abs(ranked[i].Effect) != math.Abs(ranked[j].Effect) {
+			return math.Abs(ranked[i].Effect) > math.Abs(ranked[j].Effect)
+		}
+		return ranked[i].Name < ranked[j].Name
+	})
+	return
+}
+
+// planSensitivity returns the sensitivity of the (pruned) tree. The total
+// cost is linear in the prices of everything that is bought and the total
+// time is linear in the times of everything that is made, so the effect of
+// each is the amount of it in units of its reaction.
+func planSensitivity(d *Dag, reactions map[string]Reaction) (sensitivity *PlanSensitivity) {
+	prices := make(map[string]float64)
+	serialHours := make(map[string]float64)
+	parallelHours := make(map[string]float64)
+	made := make(map[string]struct{})
+	for _, node := range getDagRoots(d, []*Dag{}) {
+		reaction, ok := reactions[node.Product.Name]
+		if !ok || reaction.Product[0].Amount == 0 {
+			continue
+		}
+		scaling := node.Product.Amount / reaction.Product[0].Amount
+		if len(node.Children) == 0 {
+			prices[node.Product.Name] += scaling
+			continue
+		}
+		made[node.Product.Name] = struct{}{}
+		if reaction.SerialHours > 0 {
+			serialHours[node.Product.Name] += scaling
+		}
+		if reaction.ParallelHours > 0 {
+			parallelHours[node.Product.Name]++
+		}
+	}
+
+	sensitivity = &PlanSensitivity{
+		Prices: rankSensitivities(prices, reactions, func(r Reaction) float64 {
+			return r.Product[0].Price * 100
+		}),
+		SerialSeconds: rankSensitivities(serialHours, reactions, func(r Reaction) float64 {
+			return r.SerialHours * 3600
+		}),
+		ParallelSeconds: rankSensitivities(parallelHours, reactions, func(r Reaction) float64 {
+			return r.ParallelHours * 3600
+		}),
+		BreakEven: []PlanBreakEven{},
+	}
+
+	// the break-even price is the price of making the amount of the
+	// reaction, which is what scratchReplacement compares buying with
+	for name := range prices {
+		made[name] = struct{}{}
+	}
+	for name := range made {
+		product := reactions[name].Product[0]
+		if product.Price == 0 {
+			continue
+		}
+		priceDifference, _, err := scratchReplacement(reactions, name, product.Amount)
+		if err != nil {
+			continue
+		}
+		_, isBought := prices[name]
+		price := toCents(product.Price)
+		scratchPrice := toCents(product.Price + priceDifference)
+		sensitivity.BreakEven = append(sensitivity.BreakEven, PlanBreakEven{
+			Name:              name,
+			Per:               canonicalQuantity(product.Amount, product.Measure),
+			PriceCents:        price,
+			ScratchPriceCents: scratchPrice,
+			Made:              !isBought,
+			MakeCheaper:       price > scratchPrice,
+		})
+	}
+	sort.Slice(sensitivity.BreakEven, func(i, j int) bool {
+		savingsI := sensitivity.BreakEven[i].PriceCents - sensitivity.BreakEven[i].ScratchPriceCents
+		savingsJ := sensitivity.BreakEven[j].PriceCents - sensitivity.BreakEven[j].ScratchPriceCents
+		if savingsI != savingsJ {
+			return savingsI > savingsJ
+		}
+		return sensitivity.BreakEven[i].Name < sensitivity.BreakEven[j].Name
+	})
+	return
+}
+
+// GetSensitivity returns how the total cost and time of the plan for the
+// request change with each price and time, and the prices at which making
+// each ingredient becomes cheaper than buying it.
+func GetSensitivity(request RequestFromApp) (sensitivity *UpdateAppSensitivity, err error) {
+	return GetSensitivityContext(context.Background(), request)
+}
+
+// GetSensitivityContext is GetSensitivity, stopping once the context is
+// done. The graph and the estimate of the plan aren't needed for it.
+func GetSensitivityContext(ctx context.Context, request RequestFromApp) (sensitivity *UpdateAppSensitivity, err error) {
+	request.Sensitivity = true
+	request.NoGraph = true
+	request.Samples = 0
+	plan, err := GetPlanContext(ctx, request)
+	if err != nil {
+		return
+	}
+	sensitivity = presentSensitivity(*plan.Sensitivity)
+	return
+}
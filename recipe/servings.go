@@ -0,0 +1,38 @@
+package recipe
+
+import (
+	"errors"
+	"math"
+)
+
+// amountForServings returns the amount of the product that makes the
+// number of servings.
+func amountForServings(product Element, servings float64) (amount float64, err error) {
+	if product.Servings <= 0 {
+		err = errors.New(product.Name + " doesn't have servings")
+		return
+	}
+	amount = servings / product.Servings * product.Amount
+	return
+}
+
+// servingsInAmount returns the number of servings in the amount of the
+// product, or zero if the product doesn't have servings.
+func servingsInAmount(product Element, amount float64) float64 {
+	if product.Servings <= 0 || product.Amount <= 0 {
+		return 0
+	}
+	return math.Round(product.Servings*amount/product.Amount*10) / 10
+}
+
+// setServings adds the servings, and the cost and time per serving, to the
+// plan.
+func setServings(plan *Plan, product Element, amount float64, totalCost float64, totalHours float64) {
+	plan.Servings = servingsInAmount(product, amount)
+	if plan.Servings == 0 {
+		return
+	}
+	plan.ServingSize = product.ServingSize
+	plan.CostPerServingCents = toCents(totalCost / plan.Servings)
+	plan.SecondsPerServing = toSeconds(totalHours / plan.Servings)
+}
@@ -0,0 +1,191 @@
+package recipe
+
+import (
+	"strings"
+)
+
+// Substitution replaces an ingredient with other ingredients, e.g. 1 cup of
+// buttermilk can be replaced by 1 cup of milk and 1 tablespoon of vinegar.
+// A reversible substitution of a single ingredient also works the other
+// way around, at the inverse ratio.
+type Substitution struct {
+	From       Element   `toml:"from" json:"from"`
+	To         []Element `toml:"to" json:"to"`
+	Reversible bool      `toml:"reversible" json:"reversible,omitempty"`
+	Notes      string    `toml:"notes" json:"notes,omitempty"`
+}
+
+// Reasons that an ingredient is substituted
+const (
+	SubstitutedUnavailable = "unavailable"
+	SubstitutedExcluded    = "excluded"
+	SubstitutedCheaper     = "cheaper"
+)
+
+type UpdateAppSubstitution struct {
+	// In is the name of what is made with the substitution
+	In     string   `json:"in"`
+	From   string   `json:"from"`
+	To     []string `json:"to"`
+	Reason string   `json:"reason"`
+}
+
+// indexSubstitutions returns the substitutions for each ingredient,
+// including the reverse of the reversible ones.
+func indexSubstitutions(substitutions []Substitution) (index map[string][]Substitution) {
+	index = make(map[string][]Substitution)
+	for _, s := range substitutions {
+		if s.From.Amount == 0 || len(s.To) == 0 {
+			continue
+		}
+		index[s.From.Name] = append(index[s.From.Name], s)
+		if s.Reversible && len(s.To) == 1 && s.To[0].Amount != 0 {
+			index[s.To[0].Name] = append(index[s.To[0].Name], Substitution{
+				From:  s.To[0],
+				To:    []Element{s.From},
+				Notes: s.Notes,
+			})
+		}
+	}
+	return
+}
+
+// buyPrice returns the price of buying the element
+func buyPrice(reactions map[string]Reaction, e Element) (price float64, ok bool) {
+	reaction, hasReaction := reactions[e.Name]
+	if !hasReaction || reaction.Product[0].Amount == 0 {
+		return
+	}
+	amount, ok := convertMeasure(e.Amount, e.Measure, reaction.Product[0].Measure)
+	if !ok {
+		return
+	}
+	price = reaction.Product[0].Price * amount / reaction.Product[0].Amount
+	return
+}
+
+// substitute returns what replaces the reactant, scaled to its amount
+func substitute(s Substitution, reactant Element) (replacement []Element, ok bool) {
+	amount, ok := convertMeasure(reactant.Amount, reactant.Measure, s.From.Measure)
+	if !ok {
+		return
+	}
+	scaling := amount / s.From.Amount
+	replacement = make([]Element, len(s.To))
+	for i, to := range s.To {
+		replacement[i] = Element{
+			Name:    to.Name,
+			Amount:  to.Amount * scaling,
+			Measure: to.Measure,
+			Notes:   to.Notes,
+		}
+	}
+	return
+}
+
+// applySubstitutions replaces the reactants of every reaction that are
+// unavailable, that have tags that are excluded no matter how they are
+// made, or, if cheaper is set, that are cheaper to buy as a substitute.
+// The directions of the reaction are annotated with the substitution.
+func applySubstitutions(reactions map[string]Reaction, substitutions []Substitution, unavailable map[string]struct{}, excluded map[string]struct{}, cheaper bool) (substituted map[string]Reaction) {
+	index := indexSubstitutions(substitutions)
+	// acceptable checks that the replacement doesn't need substituting too
+	acceptable := func(replacement []Element) bool {
+		for _, e := range replacement {
+			if _, ok := unavailable[e.Name]; ok {
+				return false
+			}
+			if forbiddenTag(declaredTags(reactions, e.Name), excluded) != "" {
+				return false
+			}
+		}
+		return true
+	}
+	substituteReactants := func(name string, reaction Reaction) Reaction {
+		reactants := []Element{}
+		for _, reactant := range reaction.Reactant {
+			reason := ""
+			if _, ok := unavailable[reactant.Name]; ok {
+				reason = SubstitutedUnavailable
+			} else if forbiddenTag(declaredTags(reactions, reactant.Name), excluded) != "" {
+				reason = SubstitutedExcluded
+			} else if cheaper {
+				reason = SubstitutedCheaper
+			}
+
+			var replacement []Element
+			if reason != "" {
+				for _, s := range index[reactant.Name] {
+					candidate, ok := substitute(s, reactant)
+					if !ok || !acceptable(candidate) {
+						continue
+					}
+					if reason == SubstitutedCheaper {
+						price, ok1 := buyPrice(reactions, reactant)
+						candidatePrice := 0.0
+						for _, e := range candidate {
+							p, ok2 := buyPrice(reactions, e)
+							ok1 = ok1 && ok2
+							candidatePrice += p
+						}
+						if !ok1 || candidatePrice >= price {
+							continue
+						}
+					}
+					replacement = candidate
+					break
+				}
+			}
+			if replacement == nil {
+				reactants = append(reactants, reactant)
+				continue
+			}
+
+			reactants = append(reactants, replacement...)
+			names := make([]string, len(replacement))
+			for i, e := range replacement {
+				names[i] = e.Name
+			}
+			reaction.substitutions = append(reaction.substitutions, UpdateAppSubstitution{
+				In:     name,
+				From:   reactant.Name,
+				To:     names,
+				Reason: reason,
+			})
+			reaction.Directions = strings.TrimSpace(reaction.Directions) + "\nUse " + strings.Join(names, " and ") + " instead of " + reactant.Name + "."
+		}
+		reaction.Reactant = reactants
+		return reaction
+	}
+
+	substituted = make(map[string]Reaction)
+	for name, reaction := range reactions {
+		alternatives := make([]Reaction, len(reaction.alternatives))
+		for i, alternative := range reaction.alternatives {
+			alternatives[i] = substituteReactants(name, alternative)
+		}
+		reaction = substituteReactants(name, reaction)
+		reaction.alternatives = alternatives
+		substituted[name] = reaction
+	}
+	return
+}
+
+// planSubstitutions returns the substitutions in everything that is made
+func planSubstitutions(d *Dag, reactions map[string]Reaction) (substitutions []UpdateAppSubstitution) {
+	substitutions = []UpdateAppSubstitution{}
+	have := make(map[string]struct{})
+	for _, root := range getDagRoots(d, []*Dag{}) {
+		if len(root.Children) == 0 {
+			continue
+		}
+		for _, s := range reactions[root.Product.Name].substitutions {
+			if _, ok := have[s.In+"/"+s.From]; ok {
+				continue
+			}
+			have[s.In+"/"+s.From] = struct{}{}
+			substitutions = append(substitutions, s)
+		}
+	}
+	return
+}
@@ -0,0 +1,191 @@
+package recipe
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WriteCatalog writes the reactions and substitutions as toml, in the same
+// layout as the catalog, leaving out whatever isn't set
+func WriteCatalog(w io.Writer, r Reactions) (err error) {
+	b := bufio.NewWriter(w)
+	for i, reaction := range r.Reactions {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		writeReaction(b, reaction)
+	}
+	for i, substitution := range r.Substitutions {
+		if i > 0 || len(r.Reactions) > 0 {
+			b.WriteString("\n")
+		}
+		writeSubstitution(b, substitution)
+	}
+	return b.Flush()
+}
+
+func writeReaction(b *bufio.Writer, reaction Reaction) {
+	b.WriteString("[[reaction]]\n")
+	if reaction.Published {
+		b.WriteString("published = true\n")
+	}
+	if reaction.Featured {
+		b.WriteString("featured = true\n")
+	}
+	writeString(b, "", "title", reaction.Title)
+	writeString(b, "", "description", reaction.Description)
+	writeString(b, "", "category", reaction.Category)
+	writeString(b, "", "image", reaction.Image)
+	if !reaction.LastUpdated.IsZero() {
+		writeString(b, "", "updated", reaction.LastUpdated.Format(time.RFC3339))
+	}
+	writeFloat(b, "", "s_hours", reaction.SerialHours)
+	writeFloat(b, "", "p_hours", reaction.ParallelHours)
+	writeFloat(b, "", "s_hours_min", reaction.SerialHoursMin)
+	writeFloat(b, "", "s_hours_max", reaction.SerialHoursMax)
+	writeFloat(b, "", "p_hours_min", reaction.ParallelHoursMin)
+	writeFloat(b, "", "p_hours_max", reaction.ParallelHoursMax)
+	if reaction.Footprint != nil {
+		fmt.Fprintf(b, "footprint = %s\n", footprintTable(*reaction.Footprint))
+	}
+	if reaction.Season != nil {
+		fmt.Fprintf(b, "season = %s\n", seasonTable(*reaction.Season))
+	}
+	writeText(b, "", "directions", reaction.Directions)
+	writeText(b, "", "notes", reaction.Notes)
+	for _, product := range reaction.Product {
+		b.WriteString("\n\t[[reaction.product]]\n")
+		writeElement(b, product)
+	}
+	for _, reactant := range reaction.Reactant {
+		b.WriteString("\n\t[[reaction.reactant]]\n")
+		writeElement(b, reactant)
+	}
+}
+
+func writeSubstitution(b *bufio.Writer, substitution Substitution) {
+	b.WriteString("[[substitution]]\n")
+	if substitution.Reversible {
+		b.WriteString("reversible = true\n")
+	}
+	writeText(b, "", "notes", substitution.Notes)
+	b.WriteString("\t[substitution.from]\n")
+	writeElement(b, substitution.From)
+	for _, to := range substitution.To {
+		b.WriteString("\n\t[[substitution.to]]\n")
+		writeElement(b, to)
+	}
+}
+
+func writeElement(b *bufio.Writer, e Element) {
+	fmt.Fprintf(b, "\t\tname=%s\n", tomlString(e.Name))
+	writeFloat(b, "\t\t", "amount", e.Amount)
+	writeString(b, "\t\t", "measure", e.Measure)
+	writeFloat(b, "\t\t", "price", e.Price)
+	writeFloat(b, "\t\t", "price_min", e.PriceMin)
+	writeFloat(b, "\t\t", "price_max", e.PriceMax)
+	writeFloat(b, "\t\t", "servings", e.Servings)
+	writeString(b, "\t\t", "serving_size", e.ServingSize)
+	if e.FoodDataID != 0 {
+		fmt.Fprintf(b, "\t\tfdc_id = %d\n", e.FoodDataID)
+	}
+	writeFloat(b, "\t\t", "grams", e.Grams)
+	if e.Tags != nil {
+		tags := make([]string, len(e.Tags))
+		for i, tag := range e.Tags {
+			tags[i] = tomlString(tag)
+		}
+		fmt.Fprintf(b, "\t\ttags = [%s]\n", strings.Join(tags, ", "))
+	}
+	if e.Nutrition != nil {
+		n := e.Nutrition
+		fmt.Fprintf(b, "\t\tnutrition = { calories = %s, protein = %s, fat = %s, carbs = %s, fiber = %s, sodium = %s }\n",
+			tomlFloat(n.Calories), tomlFloat(n.Protein), tomlFloat(n.Fat), tomlFloat(n.Carbs), tomlFloat(n.Fiber), tomlFloat(n.Sodium))
+	}
+	if e.Footprint != nil {
+		fmt.Fprintf(b, "\t\tfootprint = %s\n", footprintTable(*e.Footprint))
+	}
+	writeText(b, "\t\t", "notes", e.Notes)
+}
+
+func footprintTable(f Footprint) string {
+	return fmt.Sprintf("{ land = %s, water = %s, co2e = %s, energy = %s }",
+		tomlFloat(f.Land), tomlFloat(f.Water), tomlFloat(f.CO2e), tomlFloat(f.Energy))
+}
+
+func seasonTable(s Season) string {
+	months := make([]string, len(s.Months))
+	for i, month := range s.Months {
+		months[i] = strconv.Itoa(month)
+	}
+	table := fmt.Sprintf("{ months = [%s]", strings.Join(months, ", "))
+	if s.HarvestLag != 0 {
+		table += ", harvest_lag = " + tomlFloat(s.HarvestLag)
+	}
+	return table + " }"
+}
+
+func writeString(b *bufio.Writer, indent, key, value string) {
+	if value != "" {
+		fmt.Fprintf(b, "%s%s = %s\n", indent, key, tomlString(value))
+	}
+}
+
+func writeFloat(b *bufio.Writer, indent, key string, value float64) {
+	if value != 0 {
+		fmt.Fprintf(b, "%s%s = %s\n", indent, key, tomlFloat(value))
+	}
+}
+
+// writeText writes text with more than one line as a multi-line string,
+// like the directions
+func writeText(b *bufio.Writer, indent, key, value string) {
+	if !strings.Contains(value, "\n") {
+		writeString(b, indent, key, value)
+		return
+	}
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"""`, `""\"`, -1)
+	if strings.HasSuffix(value, `"`) {
+		value = value[:len(value)-1] + `\"`
+	}
+	fmt.Fprintf(b, "%s%s = \"\"\"\n%s\"\"\"\n", indent, key, value)
+}
+
+// tomlFloat formats floats like the catalog, which always has a decimal
+// point
+func tomlFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(s, ".") {
+		s += ".0"
+	}
+	return s
+}
+
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
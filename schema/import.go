@@ -0,0 +1,232 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/ingredient"
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// jsonLD matches the JSON-LD scripts of a page
+var jsonLD = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+
+// Extract returns the Recipes in the JSON-LD of an HTML page, which can
+// be at the top, in a list or in a @graph
+func Extract(page []byte) (recipes []Recipe, err error) {
+	recipes = []Recipe{}
+	for _, m := range jsonLD.FindAllSubmatch(page, -1) {
+		var v interface{}
+		if err = json.Unmarshal(m[1], &v); err != nil {
+			err = fmt.Errorf("bad JSON-LD: %w", err)
+			return
+		}
+		for _, object := range findRecipes(v) {
+			recipes = append(recipes, recipeFromObject(object))
+		}
+	}
+	if len(recipes) == 0 {
+		err = fmt.Errorf("no Recipe in the JSON-LD")
+	}
+	return
+}
+
+// findRecipes returns every object that is a Recipe
+func findRecipes(v interface{}) (objects []map[string]interface{}) {
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			objects = append(objects, findRecipes(item)...)
+		}
+	case map[string]interface{}:
+		for _, t := range texts(v["@type"]) {
+			if t == "Recipe" {
+				return []map[string]interface{}{v}
+			}
+		}
+		for _, value := range v {
+			objects = append(objects, findRecipes(value)...)
+		}
+	}
+	return
+}
+
+// texts returns the text of a value, which can be a string, a number, an
+// object with a url or a name, or a list of them
+func texts(v interface{}) (s []string) {
+	switch v := v.(type) {
+	case string:
+		if v = cleanText(v); v != "" {
+			s = append(s, v)
+		}
+	case float64:
+		s = append(s, strconv.FormatFloat(v, 'f', -1, 64))
+	case []interface{}:
+		for _, item := range v {
+			s = append(s, texts(item)...)
+		}
+	case map[string]interface{}:
+		for _, key := range []string{"url", "name", "text"} {
+			if _, ok := v[key]; ok {
+				return texts(v[key])
+			}
+		}
+	}
+	return
+}
+
+func text(v interface{}) string {
+	s := texts(v)
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// cleanText removes the markup and extra spaces that sites leave in
+func cleanText(s string) string {
+	s = html.UnescapeString(htmlTag.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// instructions returns the text of each step, which can be a string with
+// a step on each line, a list of strings or HowToSteps, or HowToSections
+// with their own steps
+func instructions(v interface{}) (steps []string) {
+	switch v := v.(type) {
+	case string:
+		for _, line := range strings.Split(v, "\n") {
+			if line = cleanText(line); line != "" {
+				steps = append(steps, line)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			steps = append(steps, instructions(item)...)
+		}
+	case map[string]interface{}:
+		if items, ok := v["itemListElement"]; ok {
+			return instructions(items)
+		}
+		steps = append(steps, texts(v["text"])...)
+	}
+	return
+}
+
+func recipeFromObject(object map[string]interface{}) (r Recipe) {
+	r = Recipe{
+		Context:      "https://schema.org",
+		Type:         "Recipe",
+		Name:         text(object["name"]),
+		Description:  text(object["description"]),
+		Image:        text(object["image"]),
+		URL:          text(object["url"]),
+		Category:     text(object["recipeCategory"]),
+		Yield:        text(object["recipeYield"]),
+		PrepTime:     text(object["prepTime"]),
+		CookTime:     text(object["cookTime"]),
+		TotalTime:    text(object["totalTime"]),
+		Ingredients:  texts(object["recipeIngredient"]),
+		Instructions: []HowToStep{},
+	}
+	if len(r.Ingredients) == 0 {
+		r.Ingredients = texts(object["ingredients"])
+	}
+	for _, step := range instructions(object["recipeInstructions"]) {
+		r.Instructions = append(r.Instructions, HowToStep{Type: "HowToStep", Text: step})
+	}
+	return
+}
+
+// Unparsed is an ingredient line that couldn't be made into an Element,
+// and why, for someone to review
+type Unparsed struct {
+	Line   string `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// Reaction converts the Recipe into a reaction that makes it from its
+// ingredients, with the lines that couldn't be converted. The reaction
+// isn't published until it has been reviewed.
+func Reaction(r Recipe) (reaction recipe.Reaction, unparsed []Unparsed) {
+	unparsed = []Unparsed{}
+	name := strings.ToLower(r.Name)
+	reaction = recipe.Reaction{
+		Title:       r.Name,
+		Description: r.Description,
+		Image:       r.Image,
+		Category:    strings.ToLower(r.Category),
+		Product:     []recipe.Element{{Name: name, Amount: 1, Measure: "whole"}},
+		Reactant:    []recipe.Element{},
+	}
+	if r.URL != "" {
+		reaction.Notes = fmt.Sprintf("[imported from %s](%s)", r.Name, r.URL)
+	}
+
+	// preparing scales with the amount but cooking mostly doesn't
+	var hours [3]float64
+	for i, d := range []string{r.PrepTime, r.CookTime, r.TotalTime} {
+		if d == "" {
+			continue
+		}
+		var err error
+		if hours[i], err = ParseDuration(d); err != nil {
+			unparsed = append(unparsed, Unparsed{Line: d, Reason: err.Error()})
+		}
+	}
+	if hours[0] > 0 || hours[1] > 0 {
+		reaction.SerialHours, reaction.ParallelHours = hours[0], hours[1]
+	} else {
+		reaction.SerialHours = hours[2]
+	}
+
+	if servings, size := parseYield(r.Yield); servings > 0 {
+		reaction.Product[0].Servings = servings
+		reaction.Product[0].ServingSize = size
+	}
+
+	for _, text := range r.Ingredients {
+		l := ingredient.Parse(text)
+		if !l.OK() {
+			unparsed = append(unparsed, Unparsed{Line: text, Reason: strings.Join(l.Problems, ", ")})
+			continue
+		}
+		reaction.Reactant = append(reaction.Reactant, recipe.Element{
+			Name:    l.Element.Name,
+			Amount:  l.Element.Amount,
+			Measure: l.Element.Measure,
+		})
+	}
+
+	steps := []string{}
+	for _, step := range r.Instructions {
+		steps = append(steps, step.Text)
+	}
+	if len(steps) > 0 {
+		reaction.Directions = strings.Join(steps, "\n") + "\n"
+	}
+	return
+}
+
+var yieldPattern = regexp.MustCompile(`^(?:makes |serves |yield:? )?([\d.]+)(?:\s*(?:-|to)\s*[\d.]+)?\s*(.*)$`)
+
+// parseYield returns the servings of a yield like "8", "8 servings" or
+// "24 cookies", and the serving size, e.g. "1 cookie"
+func parseYield(yield string) (servings float64, size string) {
+	m := yieldPattern.FindStringSubmatch(strings.ToLower(strings.TrimSpace(yield)))
+	if m == nil {
+		return
+	}
+	servings, _ = strconv.ParseFloat(m[1], 64)
+	unit := strings.Fields(m[2])
+	if len(unit) > 0 && !strings.HasPrefix(unit[0], "serving") && !strings.HasPrefix(unit[0], "people") && !strings.HasPrefix(unit[0], "person") {
+		size = "1 " + strings.TrimSuffix(strings.Join(unit, " "), "s")
+	}
+	return
+}
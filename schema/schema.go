@@ -0,0 +1,156 @@
+// Package schema converts between recipes and schema.org Recipe JSON-LD,
+// which is what search engines read from recipe pages, and what most
+// recipe sites embed in theirs.
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/schollz/recursive-recipes/recipe"
+)
+
+// Recipe is a schema.org Recipe
+type Recipe struct {
+	Context      string          `json:"@context"`
+	Type         string          `json:"@type"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	Image        string          `json:"image,omitempty"`
+	URL          string          `json:"url,omitempty"`
+	Category     string          `json:"recipeCategory,omitempty"`
+	Yield        string          `json:"recipeYield,omitempty"`
+	PrepTime     string          `json:"prepTime,omitempty"`
+	CookTime     string          `json:"cookTime,omitempty"`
+	TotalTime    string          `json:"totalTime,omitempty"`
+	Ingredients  []string        `json:"recipeIngredient"`
+	Instructions []HowToStep     `json:"recipeInstructions"`
+	Cost         *MonetaryAmount `json:"estimatedCost,omitempty"`
+}
+
+// HowToStep is a step of the instructions
+type HowToStep struct {
+	Type string `json:"@type"`
+	Text string `json:"text"`
+}
+
+// MonetaryAmount is the estimated cost
+type MonetaryAmount struct {
+	Type     string  `json:"@type"`
+	Currency string  `json:"currency"`
+	Value    float64 `json:"value"`
+}
+
+// New returns the schema.org Recipe of the recipe and its plan, which
+// should only make the recipe itself so that the ingredients are its
+// reactants
+func New(info recipe.RecipeInfo, plan recipe.Plan) (r Recipe) {
+	r = Recipe{
+		Context:      "https://schema.org",
+		Type:         "Recipe",
+		Name:         info.Title,
+		Description:  info.Description,
+		Image:        info.Image,
+		Category:     info.Category,
+		Yield:        recipe.FormatQuantity(plan.Quantity),
+		TotalTime:    Duration(plan.Seconds),
+		Ingredients:  []string{},
+		Instructions: []HowToStep{},
+		Cost: &MonetaryAmount{
+			Type:     "MonetaryAmount",
+			Currency: "USD",
+			Value:    float64(plan.CostCents) / 100,
+		},
+	}
+	if plan.Servings > 0 {
+		r.Yield = fmt.Sprintf("%g servings", plan.Servings)
+	}
+	for _, ing := range plan.Ingredients {
+		r.Ingredients = append(r.Ingredients, ingredientLine(ing.Name, ing.Quantity))
+	}
+	for _, step := range plan.Steps {
+		if len(step.Texts) == 0 {
+			r.Instructions = append(r.Instructions, HowToStep{Type: "HowToStep", Text: "Make " + step.Name + "."})
+		}
+		for _, text := range step.Texts {
+			r.Instructions = append(r.Instructions, HowToStep{Type: "HowToStep", Text: text})
+		}
+	}
+	return
+}
+
+// ingredientLine is how recipes write an ingredient, e.g. "1 ½ cups flour"
+// or "2 egg"
+func ingredientLine(name string, q recipe.Quantity) string {
+	amount := recipe.FormatQuantity(q)
+	if q.Unit == "whole" {
+		amount = strings.TrimSpace(strings.TrimSuffix(amount, "whole"))
+	}
+	if amount == "" {
+		return name
+	}
+	return amount + " " + name
+}
+
+// Duration formats seconds as an ISO 8601 duration, e.g. "PT1H30M" or
+// "P2DT4H"
+func Duration(seconds int64) (s string) {
+	if seconds <= 0 {
+		return "PT0S"
+	}
+	days := seconds / 86400
+	hours := seconds % 86400 / 3600
+	minutes := seconds % 3600 / 60
+	seconds = seconds % 60
+	s = "P"
+	if days > 0 {
+		s += fmt.Sprintf("%dD", days)
+	}
+	if hours == 0 && minutes == 0 && seconds == 0 {
+		return
+	}
+	s += "T"
+	if hours > 0 {
+		s += fmt.Sprintf("%dH", hours)
+	}
+	if minutes > 0 {
+		s += fmt.Sprintf("%dM", minutes)
+	}
+	if seconds > 0 {
+		s += fmt.Sprintf("%dS", seconds)
+	}
+	return
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:([\d.]+)Y)?(?:([\d.]+)M)?(?:([\d.]+)W)?(?:([\d.]+)D)?(?:T(?:([\d.]+)H)?(?:([\d.]+)M)?(?:([\d.]+)S)?)?$`)
+
+// hoursPerPart are the hours in each part of an ISO 8601 duration, where
+// years and months are approximate
+var hoursPerPart = []float64{365 * 24, 30 * 24, 7 * 24, 24, 1, 1.0 / 60, 1.0 / 3600}
+
+// ParseDuration returns the hours of an ISO 8601 duration
+func ParseDuration(s string) (hours float64, err error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil || s == "P" || strings.HasSuffix(s, "T") {
+		err = fmt.Errorf("bad duration %q", s)
+		return
+	}
+	for i, part := range m[1:] {
+		if part == "" {
+			continue
+		}
+		var value float64
+		value, err = strconv.ParseFloat(part, 64)
+		if err != nil {
+			err = fmt.Errorf("bad duration %q", s)
+			return
+		}
+		hours += value * hoursPerPart[i]
+	}
+	hours = math.Round(hours*3600) / 3600
+	return
+}
@@ -0,0 +1,127 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	recipe.CatalogFile = "../recipes.toml"
+	info, err := recipe.PublishedRecipe("apple pie")
+	assert.Nil(t, err)
+	plan, err := recipe.GetPlan(recipe.RequestFromApp{
+		Recipe:             "apple pie",
+		IngredientsToBuild: map[string]struct{}{"apple pie": {}},
+		NoGraph:            true,
+	})
+	assert.Nil(t, err)
+	r := New(info, plan)
+	assert.Equal(t, "Apple Pie", r.Name)
+	assert.Equal(t, "8 servings", r.Yield)
+	assert.Equal(t, Duration(plan.Seconds), r.TotalTime)
+	assert.Equal(t, "USD", r.Cost.Currency)
+	assert.InDelta(t, float64(plan.CostCents)/100, r.Cost.Value, 0.001)
+	assert.Equal(t, len(plan.Ingredients), len(r.Ingredients))
+	assert.Contains(t, r.Ingredients, "½ cup brown sugar")
+	assert.Contains(t, r.Ingredients, "1 teaspoon salt")
+	assert.True(t, strings.HasPrefix(r.Instructions[0].Text, "Preheat oven"))
+
+	b, err := json.Marshal(r)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(b), `{"@context":"https://schema.org","@type":"Recipe","name":"Apple Pie"`))
+}
+
+func TestDuration(t *testing.T) {
+	assert.Equal(t, "PT0S", Duration(0))
+	assert.Equal(t, "PT1H30M", Duration(5400))
+	assert.Equal(t, "P2DT4H", Duration(2*86400+4*3600))
+	assert.Equal(t, "P1D", Duration(86400))
+	assert.Equal(t, "PT45S", Duration(45))
+
+	for s, hours := range map[string]float64{
+		"PT1H30M": 1.5,
+		"P2DT4H":  52,
+		"PT45M":   0.75,
+		"pt0.5h":  0.5,
+		"P1W":     168,
+	} {
+		h, err := ParseDuration(s)
+		assert.Nil(t, err, s)
+		assert.InDelta(t, hours, h, 0.001, s)
+	}
+	for _, s := range []string{"", "P", "PT", "1H", "PT1X"} {
+		_, err := ParseDuration(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+const page = `<html><head>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "WebSite", "name": "Cookies Inc"},
+  {"@type": ["Recipe", "NewsArticle"],
+   "name": "Sugar Cookies",
+   "description": "Soft &amp; chewy",
+   "image": [{"@type": "ImageObject", "url": "https://example.com/cookies.jpg"}],
+   "url": "https://example.com/sugar-cookies",
+   "recipeCategory": ["Dessert"],
+   "recipeYield": ["24", "24 cookies"],
+   "prepTime": "PT15M",
+   "cookTime": "PT10M",
+   "totalTime": "PT25M",
+   "recipeIngredient": [
+     "2 ¾ cups all-purpose flour",
+     "1 1/2 tsp. baking soda",
+     "1½ Tbsp milk (cold)",
+     "2 eggs, beaten",
+     "8 ounces butter",
+     "salt to taste"
+   ],
+   "recipeInstructions": [
+     {"@type": "HowToSection", "name": "Dough", "itemListElement": [
+       {"@type": "HowToStep", "text": "Mix the <b>flour</b> and soda."},
+       {"@type": "HowToStep", "text": "Beat in the butter, eggs and milk."}
+     ]},
+     "Bake at 375 degrees F."
+   ]}
+]}
+</script>
+</head></html>`
+
+func TestImport(t *testing.T) {
+	recipes, err := Extract([]byte(page))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(recipes))
+	r := recipes[0]
+	assert.Equal(t, "Sugar Cookies", r.Name)
+	assert.Equal(t, "Soft & chewy", r.Description)
+	assert.Equal(t, "https://example.com/cookies.jpg", r.Image)
+	assert.Equal(t, 3, len(r.Instructions))
+	assert.Equal(t, "Mix the flour and soda.", r.Instructions[0].Text)
+
+	reaction, unparsed := Reaction(r)
+	assert.Equal(t, "sugar cookies", reaction.Product[0].Name)
+	assert.Equal(t, 24.0, reaction.Product[0].Servings)
+	assert.Equal(t, "dessert", reaction.Category)
+	assert.False(t, reaction.Published)
+	assert.Equal(t, 0.25, reaction.SerialHours)
+	assert.InDelta(t, 1.0/6, reaction.ParallelHours, 0.001)
+	assert.Equal(t, "Mix the flour and soda.\nBeat in the butter, eggs and milk.\nBake at 375 degrees F.\n", reaction.Directions)
+	assert.Equal(t, []recipe.Element{
+		{Name: "all-purpose flour", Amount: 2.75, Measure: "cup"},
+		{Name: "baking soda", Amount: 1.5, Measure: "teaspoon"},
+		{Name: "milk", Amount: 1.5, Measure: "tablespoon"},
+		{Name: "egg", Amount: 2, Measure: "whole"},
+	}, reaction.Reactant)
+	assert.Equal(t, []Unparsed{
+		{Line: "8 ounces butter", Reason: "measured by weight, which has to be converted to a volume or to whole"},
+		{Line: "salt to taste", Reason: "no amount"},
+	}, unparsed)
+
+	_, err = Extract([]byte("<html></html>"))
+	assert.NotNil(t, err)
+}
@@ -24,8 +24,14 @@ class App extends Component {
       super(props);
 
       this.timeout = null;
+      this.requestID = 0;
+      // a permalink (/p/:id) has the saved request in the page
+      this.savedRequest = window.savedRequest || null;
       // PRODUCTION
       let websocketURL ="ws"+window.origin.substring(4,window.origin.length)+window.location.pathname.replace("/recipe/","/ws/");
+      if (this.savedRequest !== null) {
+        websocketURL = "ws"+window.origin.substring(4,window.origin.length)+"/ws/"+this.savedRequest.recipe.replace(/ /g,'-');
+      }
 
       // DEBUG
       // let websocketURL = "ws://127.0.0.1:8012/ws/chocolate-chip-cookies";
@@ -44,6 +50,9 @@ class App extends Component {
       // // Reconnect 10s later
       // setTimeout(this.ws.reconnect, 10e3);
       let recipe = window.location.pathname.replace("/recipe/","").replace(/-/g,' ').replace(/\//g,' ').trim();
+      if (this.savedRequest !== null) {
+        recipe = this.savedRequest.recipe;
+      }
       console.log("websocketURL:"+websocketURL);
       this.state = {
         loading: true,
@@ -52,6 +61,8 @@ class App extends Component {
         // totalCost: "$2.30",
         // totalTime: "3 days, 2 hours",
         version: "",
+        error: "",
+        shareURL: "",
         totalCost: "",
         totalTime: "",
         amount: 0.0,
@@ -86,6 +97,13 @@ class App extends Component {
         ]
       };
       let urlParams = new URLSearchParams(window.location.search);
+      if (this.savedRequest !== null) {
+        this.state.amount = this.savedRequest.amount;
+        if (this.savedRequest.minutes > 0) {
+          this.state.limitfactor = Math.log10(this.savedRequest.minutes)/Math.log10(1.8);
+        }
+        this.state.ingredientsToBuild = this.savedRequest.ingredientsToBuild || {};
+      }
       
       if (urlParams.get('amount') != null) {
         this.state.amount = Number(urlParams.get('amount'));
@@ -106,13 +124,27 @@ class App extends Component {
 
   handleData(data) {
     // console.log(data);
-    let result = JSON.parse(data.data);
+    let reply = JSON.parse(data.data);
+    if (reply.id !== String(this.requestID)) {
+      // an answer to a request that has been superseded
+      return
+    }
+    if (reply.type === "error") {
+      console.log(reply.error);
+      this.setState({
+        loading: false,
+        error: reply.error.message,
+      })
+      return
+    }
+    let result = reply.payload;
     // console.log(result.ingredients);
     // console.log(result.minutes);
     let limitfactor =Math.log10(result.minutes)/Math.log10(1.8);
     // console.log(limitfactor);
     this.setState({
       loading:false,
+      error: "",
       // limitfactor: limitfactor,
       graph: "/"+result.graph,
       recipe: result.recipe,
@@ -123,6 +155,8 @@ class App extends Component {
       totalTime: result.totalTime,
       amount: result.amount,
       measure: result.measure,
+      servings: result.servings,
+      costPerServing: result.costPerServing,
     })
     // this.setState({
     //   limitfactor:10,
@@ -164,14 +198,41 @@ handleClick2 = (data,e) => {
   this.requestFromServer();
 }
 
-  requestFromServer() {
-	history.push(window.location.pathname + "?amount="+this.state.amount + "&timelimit=" + Math.round(Math.pow(1.8,this.state.limitfactor)) + "&ingredientsToBuild="+Object.keys(this.state.ingredientsToBuild).join(","));
-    let payload = JSON.stringify({
+  currentRequest() {
+    // keep everything else that was saved, like the diet
+    return Object.assign({}, this.savedRequest, {
       recipe: this.state.recipe.toLowerCase(),
       ingredientsToBuild: this.state.ingredientsToBuild,
       minutes: Math.pow(1.8,this.state.limitfactor),
       amount: this.state.amount,
     });
+  }
+
+  handleShare = (e) => {
+    e.preventDefault();
+    fetch("/api/plans", {
+      method: "POST",
+      headers: {"Content-Type": "application/json"},
+      body: JSON.stringify(this.currentRequest()),
+    }).then(response => response.json()).then(result => {
+      if (result.url !== undefined) {
+        this.setState({
+          shareURL: window.origin + result.url,
+        })
+      }
+    });
+  }
+
+  requestFromServer() {
+    if (this.savedRequest === null) {
+	history.push(window.location.pathname + "?amount="+this.state.amount + "&timelimit=" + Math.round(Math.pow(1.8,this.state.limitfactor)) + "&ingredientsToBuild="+Object.keys(this.state.ingredientsToBuild).join(","));
+    }
+    this.requestID++;
+    let payload = JSON.stringify({
+      type: "plan",
+      id: String(this.requestID),
+      payload: this.currentRequest(),
+    });
     console.log("sending"+payload);
     this.ws.send(payload);
   }
@@ -267,6 +328,10 @@ handleClick2 = (data,e) => {
       <div className="boxwrapper">
         <div className="outsidebox">
             <h2>Make the {direction.name} ({direction.totalTime})</h2>
+            {direction.start &&
+            <p>Start on {direction.start}, ready on {direction.ready}.</p>
+            }
+            <p><small>{direction.why}.</small></p>
              <ol>
                {direction.texts.map((text) => <li>{text}</li> )}
             </ol>
@@ -275,7 +340,7 @@ handleClick2 = (data,e) => {
       );
     }
     const listItems = this.state.ingredients.map((ing) =>
-    <div onMouseEnter={this.onBoxMouseover.bind(this,ing)} onMouseLeave={this.onBoxMouseOut.bind(this,ing)} className={"box " + (ing.scratchCost !== '' ? 'clickable' : '')} onClick={this.handleClick.bind(this,ing.name)}>
+    <div title={ing.why} onMouseEnter={this.onBoxMouseover.bind(this,ing)} onMouseLeave={this.onBoxMouseOut.bind(this,ing)} className={"box " + (ing.scratchCost !== '' ? 'clickable' : '')} onClick={this.handleClick.bind(this,ing.name)}>
     <h3>
     <span className="small-caps">{ing.amount}{ing.cost !== '' &&
     <span> / {ing.cost}</span> 
@@ -324,8 +389,18 @@ handleClick2 = (data,e) => {
         <div className="container">
             <h2 className="hero-text">
     <span>{this.state.recipe}</span>
+    {this.state.error !== '' &&
+    <small> | {this.state.error}</small>
+    }
     <small>{costName} | </small>
     <small>{this.state.totalTime}</small>
+    {this.state.servings > 0 &&
+    <small> | {this.state.costPerServing} per serving ({this.state.servings} servings)</small>
+    }
+    <small> | <a href="#" onClick={this.handleShare} className="nounderline">share</a></small>
+    {this.state.shareURL !== '' &&
+    <small> <a href={this.state.shareURL}>{this.state.shareURL}</a></small>
+    }
     </h2>
 
             <h2 className="display-title margin-top-xl" style={{paddingTop:"1em"}}>Recipe dependency graph</h2><img src={this.state.graph} style={{paddingTop:'1em'}} />
@@ -387,6 +462,10 @@ Time limit:  {moment.duration(Math.pow(1.8,this.state.limitfactor), "minutes").f
 
           </div>
 
+) : this.state.error !== '' ? (
+<div style={{height:'60vh',margin:'auto',textAlign:'center'}}>
+<h2 className="hero-text">{this.state.error}</h2>
+</div>
 ) : (
 <div style={{height:'60vh',margin:'auto',textAlign:'center'}}>
 <img src="/static/loader.svg" />
@@ -1,43 +1,74 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/schollz/recursive-recipes/cache"
+	"github.com/schollz/recursive-recipes/card"
+	"github.com/schollz/recursive-recipes/ingredient"
 	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/schollz/recursive-recipes/store"
 )
 
 const version = "v0.2.0"
 
-var finishedRecipes = []string{
-	"refried beans",
-	"chocolate chip cookies",
-	"pancakes",
-	"yogurt",
-	"eggs benedict",
-	"english muffin",
-	"tortilla",
-	"noodles",
-	"cheese",
-	"vanilla ice cream",
-	"apple pie",
-}
-
-var finishedRecipesMap map[string]struct{}
-
-func init() {
-	finishedRecipesMap = make(map[string]struct{})
-	for _, r := range finishedRecipes {
-		finishedRecipesMap[r] = struct{}{}
+func main() {
+	flag.StringVar(&recipe.CatalogFile, "catalog", recipe.CatalogFile, "catalog of reactions, a toml file or a directory of them")
+	fdcFile := flag.String("fdc", "", "USDA FoodData Central food_nutrient.csv to import nutrition from")
+	plansDir := flag.String("plans", "plans", "directory to save shared plans in")
+	renderer := flag.String("renderer", "", "renderer of the graphs, graphviz or svg (default graphviz if dot is installed)")
+	graphsSize := flag.Int64("graphs-size", 100, "megabytes of graphs to keep")
+	graphsAge := flag.Duration("graphs-age", 30*24*time.Hour, "how long to keep graphs that aren't used")
+	maxSamples := flag.Int("max-samples", 2000, "most samples a request can estimate its cost and time with")
+	flag.Parse()
+	if *fdcFile != "" {
+		if err := recipe.LoadFoodDataCentral(*fdcFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+		return
+	}
+	if _, err := recipe.LoadCatalog(recipe.CatalogFile); err != nil {
+		log.Fatal(err)
+	}
+	recipe.MaxSamples = *maxSamples
+	var err error
+	metadataTemplate, err = template.ParseFiles("templates/metadata.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	recipe.GraphRenderer, err = recipe.NewRenderer(*renderer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	recipe.GraphCache = cache.New("graphviz", cache.Options{MaxBytes: *graphsSize << 20, MaxAge: *graphsAge, Grace: 10 * time.Minute})
+	go func() {
+		for range time.Tick(time.Minute) {
+			if err := recipe.GraphCache.Evict(); err != nil {
+				log.Println(err)
+			}
+		}
+	}()
+	plans, err = store.Open(*plansDir)
+	if err != nil {
+		log.Fatal(err)
 	}
-}
 
-func main() {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 	router.Use(middleWareHandler(), gin.Recovery())
@@ -47,34 +78,76 @@ func main() {
 	})
 	router.LoadHTMLGlob("templates/*")
 	router.GET("/ws/:recipe", wshandler)
-	router.GET("/", func(c *gin.Context) {
-		c.HTML(http.StatusOK, "main.html", gin.H{
-			"Version": version,
-			"Recipes": finishedRecipes,
-		})
+	router.GET("/api/recipes", apiRecipesHandler)
+	router.GET("/api/recipes/:name", apiRecipeHandler)
+	router.GET("/api/recipes/:name/graph", apiRecipeGraphHandler)
+	router.POST("/api/graph", apiGraphHandler)
+	router.GET("/api/recipes/:name/print", apiRecipePrintHandler)
+	router.POST("/api/print", apiPrintHandler)
+	router.GET("/api/recipes/:name/sensitivity", apiRecipeSensitivityHandler)
+	router.POST("/api/sensitivity", apiSensitivityHandler)
+	router.GET("/api/search", apiSearchHandler)
+	router.POST("/api/parse", apiParseHandler)
+	router.GET("/api/stats", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"graphs": recipe.GraphCache.Stats()})
 	})
+	router.POST("/api/plan", apiPlanHandler)
+	router.OPTIONS("/api/plan", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	router.POST("/api/plans", apiSavePlanHandler)
+	router.GET("/api/plans/:id", apiGetPlanHandler)
+	router.GET("/p/:id", permalinkHandler)
+	router.GET("/", renderIndex)
 	router.GET("/recipe/:recipe", func(c *gin.Context) {
 		recipeName := unslugify(c.Param("recipe"))
 		// log.Println("got recipe", recipeName)
-		_, ok := finishedRecipesMap[recipeName]
-		if recipeName == "" || !ok {
-			c.HTML(http.StatusOK, "main.html", gin.H{
-				"Version": version,
-				"Recipes": finishedRecipes,
-			})
+		info, err := recipe.PublishedRecipe(recipeName)
+		if recipeName == "" || err != nil {
+			renderIndex(c)
 			return
 		}
-		c.File("./scratch/app/build/index.html")
+		m := recipeMetadata(info)
+		m.Recipe = recipeSchema(c.Request.Context(), info, m)
+		renderApp(c, m)
 	})
 	router.Static("/asset-manifest.json", "./scratch/app/build/asset-manifest.json")
 	router.Static("/service-worker.js", "./scratch/app/build/service-worker.js")
 	// router.Static("/a", "./scratch/app/build/")
 	router.Static("/static", "./scratch/app/build/static")
-	router.Static("/graphviz", "./graphviz")
+	router.GET("/graphviz/:name", graphvizHandler)
 	log.Println("running on ", ":8031")
 	router.Run(":" + "8031")
 }
 
+// renderIndex lists the published recipes
+func renderIndex(c *gin.Context) {
+	recipes, err := recipe.Recipes()
+	if err != nil {
+		log.Println(err)
+	}
+	c.HTML(http.StatusOK, "main.html", gin.H{
+		"Version": version,
+		"Recipes": recipes,
+	})
+}
+
+// graphvizHandler serves a rendered graph, which marks it as used in the cache
+func graphvizHandler(c *gin.Context) {
+	f, err := recipe.GraphCache.Open(c.Param("name"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), f)
+}
+
 func slugify(s string) string {
 	return strings.ToLower(strings.Join(strings.Split(strings.TrimSpace(s), " "), "-"))
 }
@@ -93,6 +166,332 @@ var upgrader = websocket.Upgrader{
 	},
 } // use default options
 
+// message is the envelope of everything sent over the websocket. The app
+// sends a "plan" with a request as the payload, which is answered with a
+// "plan" with the same id, or with an "error".
+type message struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   *messageError   `json:"error,omitempty"`
+}
+
+type messageError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorCode returns the code and the http status of an error
+func errorCode(err error) (code string, status int) {
+	switch {
+	case errors.Is(err, recipe.ErrUnknownRecipe):
+		return "unknown_recipe", http.StatusNotFound
+	case errors.Is(err, recipe.ErrInvalidAmount):
+		return "invalid_amount", http.StatusBadRequest
+	case errors.Is(err, recipe.ErrUnitMismatch):
+		return "unit_mismatch", http.StatusBadRequest
+	case errors.Is(err, recipe.ErrCatalog):
+		return "catalog_error", http.StatusInternalServerError
+	case errors.Is(err, recipe.ErrGraph):
+		return "graph_error", http.StatusInternalServerError
+	case errors.Is(err, recipe.ErrUnavailable):
+		return "unavailable", http.StatusUnprocessableEntity
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "cancelled", http.StatusRequestTimeout
+	}
+	return "no_plan", http.StatusUnprocessableEntity
+}
+
+// prepareRequest makes sure the recipe itself is made whenever any of its
+// ingredients are
+func prepareRequest(clientPayload recipe.RequestFromApp) recipe.RequestFromApp {
+	if len(clientPayload.IngredientsToBuild) > 0 {
+		ingredientsToBuild := make(map[string]struct{})
+		for ing := range clientPayload.IngredientsToBuild {
+			ingredientsToBuild[ing] = struct{}{}
+		}
+		ingredientsToBuild[clientPayload.Recipe] = struct{}{}
+		clientPayload.IngredientsToBuild = ingredientsToBuild
+	}
+	return clientPayload
+}
+
+// getPayload computes the payload for a request from the app or the api
+func getPayload(ctx context.Context, clientPayload recipe.RequestFromApp) (serverPayload recipe.UpdateApp, err error) {
+	serverPayload, err = recipe.GetRecipeFromRequestContext(ctx, prepareRequest(clientPayload))
+	if err != nil {
+		return
+	}
+	serverPayload.Version = version
+	return
+}
+
+// apiRecipesHandler lists the published recipes
+func apiRecipesHandler(c *gin.Context) {
+	recipes, err := recipe.Recipes()
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load recipes", "code": "catalog_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recipes": recipes})
+}
+
+// recipeRequest is the request for the recipe in the path, for the amount
+// and the minutes in the query
+func recipeRequest(c *gin.Context) (clientPayload recipe.RequestFromApp, ok bool) {
+	recipeName := unslugify(c.Param("name"))
+	if _, err := recipe.PublishedRecipe(recipeName); errors.Is(err, recipe.ErrUnknownRecipe) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such recipe " + recipeName, "code": "unknown_recipe"})
+		return
+	} else if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not load recipes", "code": "catalog_error"})
+		return
+	}
+	clientPayload = recipe.RequestFromApp{Recipe: recipeName}
+	var err error
+	if amount := c.Query("amount"); amount != "" {
+		clientPayload.Amount, err = strconv.ParseFloat(amount, 64)
+	}
+	if minutes := c.Query("minutes"); minutes != "" && err == nil {
+		clientPayload.MinutesToBuild, err = strconv.ParseFloat(minutes, 64)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "invalid_amount"})
+		return
+	}
+	ok = true
+	return
+}
+
+// apiRecipeHandler returns the payload of a recipe
+func apiRecipeHandler(c *gin.Context) {
+	if clientPayload, ok := recipeRequest(c); ok {
+		apiRespond(c, clientPayload)
+	}
+}
+
+// apiRecipeGraphHandler exports the graph of a recipe
+func apiRecipeGraphHandler(c *gin.Context) {
+	if clientPayload, ok := recipeRequest(c); ok {
+		apiGraphRespond(c, clientPayload)
+	}
+}
+
+// apiGraphHandler exports the graph for the request in the body
+func apiGraphHandler(c *gin.Context) {
+	var clientPayload recipe.RequestFromApp
+	if err := c.ShouldBindJSON(&clientPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	if clientPayload.Recipe == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recipe", "code": "bad_request"})
+		return
+	}
+	apiGraphRespond(c, clientPayload)
+}
+
+// apiGraphRespond writes the graph in the format and the theme of the query,
+// which are svg and app by default
+func apiGraphRespond(c *gin.Context, clientPayload recipe.RequestFromApp) {
+	format := c.DefaultQuery("format", "svg")
+	contentType, ok := recipe.ExportFormats[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown format " + format, "code": "bad_request"})
+		return
+	}
+	theme, err := recipe.GetTheme(c.Query("theme"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	clientPayload.NoGraph = true
+	plan, err := recipe.GetPlanContext(c.Request.Context(), prepareRequest(clientPayload))
+	if err != nil {
+		log.Println(err)
+		code, status := errorCode(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	var b bytes.Buffer
+	if err = recipe.ExportGraph(c.Request.Context(), recipe.PlanGraph(plan), format, theme, &b); err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "graph_error"})
+		return
+	}
+	c.Data(http.StatusOK, contentType, b.Bytes())
+}
+
+// apiRecipePrintHandler prints the card of a recipe
+func apiRecipePrintHandler(c *gin.Context) {
+	if clientPayload, ok := recipeRequest(c); ok {
+		apiPrintRespond(c, clientPayload)
+	}
+}
+
+// apiPrintHandler prints the card for the request in the body
+func apiPrintHandler(c *gin.Context) {
+	var clientPayload recipe.RequestFromApp
+	if err := c.ShouldBindJSON(&clientPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	if clientPayload.Recipe == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recipe", "code": "bad_request"})
+		return
+	}
+	apiPrintRespond(c, clientPayload)
+}
+
+// apiPrintRespond writes the card of the plan as a printable page, or as a
+// PDF if the format in the query is pdf
+func apiPrintRespond(c *gin.Context, clientPayload recipe.RequestFromApp) {
+	format := c.DefaultQuery("format", "html")
+	if format != "html" && format != "pdf" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unknown format " + format, "code": "bad_request"})
+		return
+	}
+	clientPayload.NoGraph = true
+	plan, err := recipe.GetPlanContext(c.Request.Context(), prepareRequest(clientPayload))
+	if err != nil {
+		log.Println(err)
+		code, status := errorCode(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	var b bytes.Buffer
+	contentType := "text/html; charset=utf-8"
+	if format == "pdf" {
+		contentType = "application/pdf"
+		err = card.New(plan).PDF(&b)
+	} else {
+		err = card.New(plan).HTML(&b)
+	}
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "print_error"})
+		return
+	}
+	if format == "pdf" {
+		c.Header("Content-Disposition", `inline; filename="`+slugify(plan.Recipe)+`.pdf"`)
+	}
+	c.Data(http.StatusOK, contentType, b.Bytes())
+}
+
+// apiRecipeSensitivityHandler returns the sensitivity of the plan for a
+// recipe
+func apiRecipeSensitivityHandler(c *gin.Context) {
+	if clientPayload, ok := recipeRequest(c); ok {
+		apiSensitivityRespond(c, clientPayload)
+	}
+}
+
+// apiSensitivityHandler returns the sensitivity of the plan for the request
+// in the body
+func apiSensitivityHandler(c *gin.Context) {
+	var clientPayload recipe.RequestFromApp
+	if err := c.ShouldBindJSON(&clientPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	if clientPayload.Recipe == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recipe", "code": "bad_request"})
+		return
+	}
+	apiSensitivityRespond(c, clientPayload)
+}
+
+func apiSensitivityRespond(c *gin.Context, clientPayload recipe.RequestFromApp) {
+	sensitivity, err := recipe.GetSensitivityContext(c.Request.Context(), prepareRequest(clientPayload))
+	if err != nil {
+		log.Println(err)
+		code, status := errorCode(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	c.JSON(http.StatusOK, sensitivity)
+}
+
+// apiSearchHandler returns the products that match the query, for
+// autocomplete
+func apiSearchHandler(c *gin.Context) {
+	limit := 10
+	if l := c.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100", "code": "bad_request"})
+			return
+		}
+	}
+	results, err := recipe.Search(c.Query("q"), limit)
+	if err != nil {
+		log.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not search", "code": "catalog_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// apiParseHandler parses ingredient lines, which are either a list of lines
+// or text with a line for each ingredient
+func apiParseHandler(c *gin.Context) {
+	var body struct {
+		Lines []string `json:"lines"`
+		Text  string   `json:"text"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	texts := body.Lines
+	for _, line := range strings.Split(body.Text, "\n") {
+		if strings.TrimSpace(line) != "" {
+			texts = append(texts, line)
+		}
+	}
+	if len(texts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no lines", "code": "bad_request"})
+		return
+	}
+	if len(texts) > 500 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at most 500 lines", "code": "bad_request"})
+		return
+	}
+	lines := make([]ingredient.Line, len(texts))
+	for i, text := range texts {
+		lines[i] = ingredient.Parse(strings.TrimSpace(text))
+	}
+	c.JSON(http.StatusOK, gin.H{"lines": lines})
+}
+
+// apiPlanHandler returns the payload for the request in the body
+func apiPlanHandler(c *gin.Context) {
+	var clientPayload recipe.RequestFromApp
+	if err := c.ShouldBindJSON(&clientPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "bad_request"})
+		return
+	}
+	if clientPayload.Recipe == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no recipe", "code": "bad_request"})
+		return
+	}
+	apiRespond(c, clientPayload)
+}
+
+func apiRespond(c *gin.Context, clientPayload recipe.RequestFromApp) {
+	serverPayload, err := getPayload(c.Request.Context(), clientPayload)
+	if err != nil {
+		log.Println(err)
+		code, status := errorCode(err)
+		c.JSON(status, gin.H{"error": err.Error(), "code": code})
+		return
+	}
+	c.JSON(http.StatusOK, serverPayload)
+}
+
 func wshandler(cg *gin.Context) {
 	recipeToGet := strings.Replace(cg.Param("recipe"), "-", " ", -1)
 	if recipeToGet == "" {
@@ -124,43 +523,109 @@ func wshandler(cg *gin.Context) {
 	// serverPayloadBytes, _ := json.Marshal(serverPayload)
 	// log.Println(string(serverPayloadBytes))
 	// err = c.WriteMessage(1, serverPayloadBytes)
+	// every message is answered in the background, and a newer message
+	// cancels the answer to the previous one, so only the latest is sent
+	// once the connection is closed nothing more is sent, and the handler
+	// waits for the answers that are still being computed
+	var mutex sync.Mutex
+	var answering sync.WaitGroup
+	latest := 0
+	closed := false
+	cancel := func() {}
+	defer func() {
+		mutex.Lock()
+		closed = true
+		cancel()
+		mutex.Unlock()
+		answering.Wait()
+	}()
 	for {
-		mt, message, err := c.ReadMessage()
+		mt, messageBytes, err := c.ReadMessage()
 		if err != nil {
 			log.Println("read:", err)
 			break
 		}
-		// log.Printf("recv: %s", message)
-		var clientPayload recipe.RequestFromApp
-		err = json.Unmarshal(message, &clientPayload)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		// log.Println("clientPayload", clientPayload)
-		if len(clientPayload.IngredientsToBuild) > 0 {
-			clientPayload.IngredientsToBuild[clientPayload.Recipe] = struct{}{}
-		}
-		serverPayload, err := recipe.GetRecipe(clientPayload.Recipe, clientPayload.Amount, clientPayload.MinutesToBuild/60, clientPayload.IngredientsToBuild)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		serverPayload.Version = version
-		serverPayloadBytes, _ := json.Marshal(serverPayload)
-		// log.Println(string(serverPayloadBytes))
-		err = c.WriteMessage(mt, serverPayloadBytes)
-		if err != nil {
-			log.Println("write:", err)
-			break
-		}
+		// log.Printf("recv: %s", messageBytes)
+		mutex.Lock()
+		cancel()
+		latest++
+		seq := latest
+		ctx, cancelCtx := context.WithCancel(context.Background())
+		cancel = cancelCtx
+		mutex.Unlock()
+
+		answering.Add(1)
+		go func() {
+			defer answering.Done()
+			reply, ok := answer(ctx, messageBytes, seq)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if !ok || closed || seq != latest {
+				// log.Printf("dropping superseded %s", reply.ID)
+				return
+			}
+			replyBytes, _ := json.Marshal(reply)
+			// log.Println(string(replyBytes))
+			if err := c.WriteMessage(mt, replyBytes); err != nil {
+				log.Println("write:", err)
+			}
+		}()
+	}
+}
+
+// answer answers the messages of the websocket
+var answer = wsreply
+
+// wsreply answers a message from the app. Messages without an id get the
+// number of the message on the connection, and cancelled messages aren't
+// answered at all.
+func wsreply(ctx context.Context, messageBytes []byte, seq int) (reply message, ok bool) {
+	ok = true
+	var m message
+	err := json.Unmarshal(messageBytes, &m)
+	if err == nil && m.Type == "" {
+		// the app used to send the request without an envelope
+		m = message{Type: "plan", Payload: messageBytes}
+	}
+	reply.ID = m.ID
+	if reply.ID == "" {
+		reply.ID = strconv.Itoa(seq)
+	}
+	if err == nil && m.Type != "plan" {
+		err = errors.New("unknown message type " + m.Type)
+	}
+	var clientPayload recipe.RequestFromApp
+	if err == nil {
+		err = json.Unmarshal(m.Payload, &clientPayload)
+	}
+	if err != nil {
+		log.Println(err)
+		reply.Type = "error"
+		reply.Error = &messageError{Code: "bad_request", Message: err.Error()}
+		return
+	}
+
+	// log.Println("clientPayload", clientPayload)
+	serverPayload, err := getPayload(ctx, clientPayload)
+	if err != nil && ctx.Err() != nil {
+		ok = false
+		return
+	} else if err != nil {
+		log.Println(err)
+		code, _ := errorCode(err)
+		reply.Type = "error"
+		reply.Error = &messageError{Code: code, Message: err.Error()}
+		return
 	}
+	reply.Type = "plan"
+	reply.Payload, _ = json.Marshal(serverPayload)
+	return
 }
 
 func addCORS(c *gin.Context) {
 	c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 	c.Writer.Header().Set("Access-Control-Max-Age", "86400")
-	c.Writer.Header().Set("Access-Control-Allow-Methods", "GET")
+	c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST")
 	c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-Max")
 	c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 }
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/schollz/recursive-recipes/cache"
+	"github.com/schollz/recursive-recipes/ingredient"
+	"github.com/schollz/recursive-recipes/recipe"
+	"github.com/schollz/recursive-recipes/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	// the graphs of the tests are thrown away
+	dir, err := ioutil.TempDir("", "graphviz")
+	if err != nil {
+		panic(err)
+	}
+	recipe.GraphCache = cache.New(dir, cache.Options{MaxBytes: 10 << 20})
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// serve serves a request with the handler of the route
+func serve(method, route, target, body string, handler gin.HandlerFunc) (w *httptest.ResponseRecorder) {
+	router := gin.New()
+	router.Handle(method, route, handler)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return
+}
+
+// errorBody returns the code of an error response
+func errorBody(t *testing.T, w *httptest.ResponseRecorder) (code string) {
+	var body struct {
+		Error string `json:"error"`
+		Code  string `json:"code"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	assert.NotEmpty(t, body.Error)
+	return body.Code
+}
+
+func TestAPISensitivity(t *testing.T) {
+	w := serve("GET", "/api/recipes/:name/sensitivity", "/api/recipes/pancakes/sensitivity", "", apiRecipeSensitivityHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var sensitivity recipe.UpdateAppSensitivity
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &sensitivity))
+	assert.NotEmpty(t, sensitivity.Prices)
+
+	w = serve("POST", "/api/sensitivity", "/api/sensitivity", `{"recipe": "pancakes", "ingredientsToBuild": {"butter": {}}}`, apiSensitivityHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &sensitivity))
+	assert.NotEmpty(t, sensitivity.SerialHours)
+
+	w = serve("POST", "/api/sensitivity", "/api/sensitivity", `{"recipe": "unobtainium"}`, apiSensitivityHandler)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "unknown_recipe", errorBody(t, w))
+
+	w = serve("POST", "/api/sensitivity", "/api/sensitivity", `{`, apiSensitivityHandler)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "bad_request", errorBody(t, w))
+}
+
+func TestAPIRecipe(t *testing.T) {
+	w := serve("GET", "/api/recipes/:name", "/api/recipes/pancakes?amount=4&minutes=30", "", apiRecipeHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var payload recipe.UpdateApp
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &payload), w.Body.String())
+	assert.Equal(t, "pancakes", payload.Recipe)
+	assert.Equal(t, 4.0, payload.Amount)
+	assert.Equal(t, version, payload.Version)
+
+	for _, test := range []struct {
+		target string
+		status int
+		code   string
+	}{
+		{"/api/recipes/unobtainium", http.StatusNotFound, "unknown_recipe"},
+		{"/api/recipes/pancakes?amount=lots", http.StatusBadRequest, "invalid_amount"},
+		{"/api/recipes/pancakes?minutes=soon", http.StatusBadRequest, "invalid_amount"},
+		{"/api/recipes/pancakes?amount=-1", http.StatusBadRequest, "invalid_amount"},
+	} {
+		w := serve("GET", "/api/recipes/:name", test.target, "", apiRecipeHandler)
+		assert.Equal(t, test.status, w.Code, test.target)
+		assert.Equal(t, test.code, errorBody(t, w), test.target)
+	}
+}
+
+func TestAPIPlan(t *testing.T) {
+	w := serve("POST", "/api/plan", "/api/plan", `{"recipe": "pancakes", "amount": 2, "ingredientsToBuild": {"butter": {}}}`, apiPlanHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var payload recipe.UpdateApp
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &payload), w.Body.String())
+	assert.Equal(t, "pancakes", payload.Recipe)
+	assert.Equal(t, 2.0, payload.Amount)
+
+	for _, test := range []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"recipe": "unobtainium"}`, http.StatusNotFound, "unknown_recipe"},
+		{`{"recipe": "pancakes", "amount": -1}`, http.StatusBadRequest, "invalid_amount"},
+		{`{"recipe": "pancakes", "amount": 2, "measure": "cup"}`, http.StatusBadRequest, "unit_mismatch"},
+		{`{"recipe": "pancakes", "diet": ["keto"]}`, http.StatusUnprocessableEntity, "no_plan"},
+		{`{"recipe": "apple pie", "ingredientsToBuild": {"apple pie": {}}, "unavailable": ["cinnamon"]}`, http.StatusUnprocessableEntity, "unavailable"},
+		{`{}`, http.StatusBadRequest, "bad_request"},
+		{`{"recipe": `, http.StatusBadRequest, "bad_request"},
+		{`{"recipe": 1}`, http.StatusBadRequest, "bad_request"},
+	} {
+		w := serve("POST", "/api/plan", "/api/plan", test.body, apiPlanHandler)
+		assert.Equal(t, test.status, w.Code, test.body)
+		assert.Equal(t, test.code, errorBody(t, w), test.body)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{recipe.ErrUnknownRecipe, "unknown_recipe", http.StatusNotFound},
+		{fmt.Errorf("%w: unobtainium", recipe.ErrUnknownRecipe), "unknown_recipe", http.StatusNotFound},
+		{recipe.ErrInvalidAmount, "invalid_amount", http.StatusBadRequest},
+		{fmt.Errorf("%w: amount can't be -1", recipe.ErrInvalidAmount), "invalid_amount", http.StatusBadRequest},
+		{recipe.ErrUnitMismatch, "unit_mismatch", http.StatusBadRequest},
+		{fmt.Errorf("%w: cups, not acres", recipe.ErrUnitMismatch), "unit_mismatch", http.StatusBadRequest},
+		{fmt.Errorf("%w: butter can't be substituted or made", recipe.ErrUnavailable), "unavailable", http.StatusUnprocessableEntity},
+		{fmt.Errorf("recipes.toml: %w", recipe.ErrCatalog), "catalog_error", http.StatusInternalServerError},
+		{fmt.Errorf("%w: dot: exit status 1", recipe.ErrGraph), "graph_error", http.StatusInternalServerError},
+		{context.Canceled, "cancelled", http.StatusRequestTimeout},
+		{fmt.Errorf("dot: %w", context.DeadlineExceeded), "cancelled", http.StatusRequestTimeout},
+		{errors.New("unknown diet keto"), "no_plan", http.StatusUnprocessableEntity},
+	} {
+		code, status := errorCode(test.err)
+		assert.Equal(t, test.code, code, test.err.Error())
+		assert.Equal(t, test.status, status, test.err.Error())
+	}
+}
+
+func TestWSReply(t *testing.T) {
+	for _, test := range []struct {
+		message string
+		seq     int
+		typ     string
+		id      string
+		code    string
+	}{
+		{`{"type": "plan", "id": "a1", "payload": {"recipe": "pancakes"}}`, 1, "plan", "a1", ""},
+		{`{"type": "plan", "payload": {"recipe": "pancakes"}}`, 7, "plan", "7", ""},
+		{`{"recipe": "pancakes"}`, 3, "plan", "3", ""},
+		{`{"type": "plan", "id": "a2", "payload": {"recipe": "unobtainium"}}`, 2, "error", "a2", "unknown_recipe"},
+		{`{"type": "plan", "id": "a3", "payload": {"recipe": "pancakes", "amount": -1}}`, 3, "error", "a3", "invalid_amount"},
+		{`{"type": "plan", "id": "a4", "payload": {"recipe": "pancakes", "amount": 1, "measure": "cup"}}`, 4, "error", "a4", "unit_mismatch"},
+		{`{"type": "plan", "id": "a5", "payload": {"recipe": "pancakes", "diet": ["keto"]}}`, 5, "error", "a5", "no_plan"},
+		{`{"type": "shop", "id": "a6"}`, 6, "error", "a6", "bad_request"},
+		{`{"type": "plan", "id": "a7", "payload": {"recipe": 1}}`, 7, "error", "a7", "bad_request"},
+		{`not json`, 8, "error", "8", "bad_request"},
+	} {
+		reply, ok := wsreply(context.Background(), []byte(test.message), test.seq)
+		assert.True(t, ok, test.message)
+		assert.Equal(t, test.typ, reply.Type, test.message)
+		assert.Equal(t, test.id, reply.ID, test.message)
+		if test.code == "" {
+			assert.Nil(t, reply.Error, test.message)
+			var payload recipe.UpdateApp
+			assert.Nil(t, json.Unmarshal(reply.Payload, &payload), test.message)
+			assert.Equal(t, "pancakes", payload.Recipe)
+		} else {
+			assert.Equal(t, test.code, reply.Error.Code, test.message)
+			assert.NotEmpty(t, reply.Error.Message, test.message)
+			assert.Nil(t, reply.Payload, test.message)
+		}
+	}
+
+	// a cancelled request isn't planned, or answered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok := wsreply(ctx, []byte(`{"type": "plan", "id": "b1", "payload": {"recipe": "pancakes"}}`), 1)
+	assert.False(t, ok)
+}
+
+func TestWebsocketLatest(t *testing.T) {
+	// the first message is answered once the second one cancels it
+	cancelled := make(chan struct{})
+	answer = func(ctx context.Context, messageBytes []byte, seq int) (message, bool) {
+		if seq == 1 {
+			<-ctx.Done()
+			close(cancelled)
+		}
+		return wsreply(ctx, messageBytes, seq)
+	}
+	defer func() { answer = wsreply }()
+
+	router := gin.New()
+	router.GET("/ws/:recipe", wshandler)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws/pancakes", nil)
+	assert.Nil(t, err)
+	defer c.Close()
+
+	for _, m := range []string{
+		`{"type": "plan", "payload": {"recipe": "pancakes", "amount": 1}}`,
+		`{"type": "plan", "payload": {"recipe": "pancakes", "amount": 2}}`,
+	} {
+		assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(m)))
+	}
+	var reply message
+	assert.Nil(t, c.ReadJSON(&reply))
+	assert.Equal(t, "2", reply.ID)
+	assert.Equal(t, "plan", reply.Type)
+	var payload recipe.UpdateApp
+	assert.Nil(t, json.Unmarshal(reply.Payload, &payload))
+	assert.Equal(t, 2.0, payload.Amount)
+	<-cancelled
+
+	// the next answer is to the next message, so the first one was dropped
+	assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"type": "plan", "id": "x", "payload": {"recipe": "pancakes"}}`)))
+	assert.Nil(t, c.ReadJSON(&reply))
+	assert.Equal(t, "x", reply.ID)
+}
+
+func TestAPIRecipes(t *testing.T) {
+	w := serve("GET", "/api/recipes", "/api/recipes", "", apiRecipesHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Recipes []recipe.RecipeInfo `json:"recipes"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.NotEmpty(t, body.Recipes)
+
+	// a catalog that can't be loaded isn't a missing recipe
+	recipe.CatalogFile = "missing.toml"
+	defer func() { recipe.CatalogFile = "recipes.toml" }()
+	w = serve("GET", "/api/recipes", "/api/recipes", "", apiRecipesHandler)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "catalog_error", errorBody(t, w))
+	w = serve("GET", "/api/recipes/:name", "/api/recipes/pancakes", "", apiRecipeHandler)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "catalog_error", errorBody(t, w))
+	w = serve("POST", "/api/plan", "/api/plan", `{"recipe": "pancakes"}`, apiPlanHandler)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "catalog_error", errorBody(t, w))
+	reply, ok := wsreply(context.Background(), []byte(`{"type": "plan", "id": "c1", "payload": {"recipe": "pancakes"}}`), 1)
+	assert.True(t, ok)
+	assert.Equal(t, "catalog_error", reply.Error.Code)
+}
+
+func TestAPISearch(t *testing.T) {
+	w := serve("GET", "/api/search", "/api/search?q=pancak&limit=3", "", apiSearchHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Results []recipe.SearchResult `json:"results"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "pancakes", body.Results[0].Name)
+	assert.True(t, len(body.Results) <= 3)
+
+	w = serve("GET", "/api/search", "/api/search?q=pancakes&limit=1000", "", apiSearchHandler)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "bad_request", errorBody(t, w))
+
+	recipe.CatalogFile = "missing.toml"
+	defer func() { recipe.CatalogFile = "recipes.toml" }()
+	w = serve("GET", "/api/search", "/api/search?q=pancakes", "", apiSearchHandler)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "catalog_error", errorBody(t, w))
+}
+
+func TestGraphviz(t *testing.T) {
+	w := serve("GET", "/api/recipes/:name", "/api/recipes/pancakes", "", apiRecipeHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var payload recipe.UpdateApp
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &payload), w.Body.String())
+	name := path.Base(payload.Graph)
+
+	w = serve("GET", "/graphviz/:name", "/graphviz/"+name, "", graphvizHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Body.String())
+
+	w = serve("GET", "/graphviz/:name", "/graphviz/missing.png", "", graphvizHandler)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("GET", "/graphviz/:name", "/graphviz/..%2Fserver.go", "", graphvizHandler)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAPIGraph(t *testing.T) {
+	w := serve("GET", "/api/recipes/:name/graph", "/api/recipes/pancakes/graph?minutes=30", "", apiRecipeGraphHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/svg+xml", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<svg")
+
+	// the app theme is the default
+	app := serve("GET", "/api/recipes/:name/graph", "/api/recipes/pancakes/graph?format=dot&minutes=30&theme=app", "", apiRecipeGraphHandler)
+	assert.Equal(t, http.StatusOK, app.Code)
+	w = serve("GET", "/api/recipes/:name/graph", "/api/recipes/pancakes/graph?format=dot&minutes=30", "", apiRecipeGraphHandler)
+	assert.Equal(t, app.Body.String(), w.Body.String())
+	w = serve("GET", "/api/recipes/:name/graph", "/api/recipes/pancakes/graph?format=dot&minutes=30&theme=dark", "", apiRecipeGraphHandler)
+	assert.NotEqual(t, app.Body.String(), w.Body.String())
+
+	w = serve("POST", "/api/graph", "/api/graph?format=mermaid", `{"recipe": "pancakes"}`, apiGraphHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "flowchart TB"), w.Body.String())
+	w = serve("POST", "/api/graph", "/api/graph?format=json", `{"recipe": "pancakes"}`, apiGraphHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, json.Valid(w.Body.Bytes()))
+
+	for _, test := range []struct {
+		target, body string
+		status       int
+		code         string
+	}{
+		{"/api/graph?format=gif", `{"recipe": "pancakes"}`, http.StatusBadRequest, "bad_request"},
+		{"/api/graph?theme=sepia", `{"recipe": "pancakes"}`, http.StatusBadRequest, "bad_request"},
+		{"/api/graph", `{}`, http.StatusBadRequest, "bad_request"},
+		{"/api/graph", `{"recipe": "unobtainium"}`, http.StatusNotFound, "unknown_recipe"},
+		{"/api/graph", `{"recipe": "pancakes", "diet": ["keto"]}`, http.StatusUnprocessableEntity, "no_plan"},
+	} {
+		w = serve("POST", "/api/graph", test.target, test.body, apiGraphHandler)
+		assert.Equal(t, test.status, w.Code, test.target+" "+test.body)
+		assert.Equal(t, test.code, errorBody(t, w))
+	}
+	w = serve("GET", "/api/recipes/:name/graph", "/api/recipes/unobtainium/graph", "", apiRecipeGraphHandler)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "unknown_recipe", errorBody(t, w))
+}
+
+func TestAPIPrint(t *testing.T) {
+	w := serve("GET", "/api/recipes/:name/print", "/api/recipes/pancakes/print?minutes=30", "", apiRecipePrintHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "pancakes")
+
+	w = serve("POST", "/api/print", "/api/print?format=pdf", `{"recipe": "pancakes"}`, apiPrintHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename="pancakes.pdf"`, w.Header().Get("Content-Disposition"))
+	assert.True(t, strings.HasPrefix(w.Body.String(), "%PDF"))
+
+	for _, test := range []struct {
+		target, body string
+		status       int
+		code         string
+	}{
+		{"/api/print?format=doc", `{"recipe": "pancakes"}`, http.StatusBadRequest, "bad_request"},
+		{"/api/print", `{}`, http.StatusBadRequest, "bad_request"},
+		{"/api/print?format=pdf", `{"recipe": "unobtainium"}`, http.StatusNotFound, "unknown_recipe"},
+		{"/api/print?format=pdf", `{"recipe": "pancakes", "diet": ["keto"]}`, http.StatusUnprocessableEntity, "no_plan"},
+	} {
+		w = serve("POST", "/api/print", test.target, test.body, apiPrintHandler)
+		assert.Equal(t, test.status, w.Code, test.target+" "+test.body)
+		assert.Equal(t, test.code, errorBody(t, w))
+		assert.Empty(t, w.Header().Get("Content-Disposition"))
+	}
+}
+
+func TestAPISavePlan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plans")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	plans, err = store.Open(dir)
+	assert.Nil(t, err)
+
+	w := serve("POST", "/api/plans", "/api/plans", `{"recipe": "pancakes", "minutes": 30}`, apiSavePlanHandler)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var saved struct {
+		ID string `json:"id"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &saved))
+	w = serve("GET", "/api/plans/:id", "/api/plans/"+saved.ID, "", apiGetPlanHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "pancakes")
+
+	w = serve("POST", "/api/plans", "/api/plans", `{"recipe": "unobtainium"}`, apiSavePlanHandler)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "unknown_recipe", errorBody(t, w))
+
+	// the directory of the store is gone
+	os.RemoveAll(dir)
+	w = serve("POST", "/api/plans", "/api/plans", `{"recipe": "pancakes", "minutes": 60}`, apiSavePlanHandler)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "store_error", errorBody(t, w))
+}
+
+func TestRecipeSchema(t *testing.T) {
+	info, err := recipe.PublishedRecipe("apple pie")
+	assert.Nil(t, err)
+	m := recipeMetadata(info)
+	r := recipeSchema(context.Background(), info, m)
+	assert.NotNil(t, r)
+	assert.True(t, r == recipeSchema(context.Background(), info, m))
+
+	// it is planned again once the catalog changes
+	dir, err := ioutil.TempDir("", "catalog")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	b, err := ioutil.ReadFile("recipes.toml")
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "recipes.toml"), b, 0644))
+	recipe.CatalogFile = path.Join(dir, "recipes.toml")
+	defer func() { recipe.CatalogFile = "recipes.toml" }()
+	r2 := recipeSchema(context.Background(), info, m)
+	assert.NotNil(t, r2)
+	assert.False(t, r == r2)
+	assert.Equal(t, *r, *r2)
+}
+
+func TestAPIParse(t *testing.T) {
+	var body struct {
+		Lines []ingredient.Line `json:"lines"`
+	}
+	w := serve("POST", "/api/parse", "/api/parse", `{"text": "1 1/2 cups flour, sifted\n\n  2 eggs  \n"}`, apiParseHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, 2, len(body.Lines))
+	assert.Equal(t, "flour", body.Lines[0].Element.Name)
+	assert.Equal(t, 1.5, body.Lines[0].Element.Amount)
+	assert.Equal(t, "cup", body.Lines[0].Element.Measure)
+	assert.Equal(t, "sifted", body.Lines[0].Preparation)
+	assert.Equal(t, "2 eggs", body.Lines[1].Text)
+
+	// the lines are parsed the same way, before the text
+	w = serve("POST", "/api/parse", "/api/parse", `{"lines": ["2 eggs"], "text": "1 1/2 cups flour, sifted"}`, apiParseHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var both struct {
+		Lines []ingredient.Line `json:"lines"`
+	}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &both))
+	assert.Equal(t, []ingredient.Line{body.Lines[1], body.Lines[0]}, both.Lines)
+
+	for _, bad := range []string{
+		`{`,
+		`{}`,
+		`{"text": "\n  \n"}`,
+		`{"text": "` + strings.Repeat(`1 egg\n`, 501) + `"}`,
+		`{"lines": [` + strings.Repeat(`"1 egg", `, 500) + `"1 egg"]}`,
+	} {
+		w = serve("POST", "/api/parse", "/api/parse", bad, apiParseHandler)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "bad_request", errorBody(t, w))
+	}
+	w = serve("POST", "/api/parse", "/api/parse", `{"text": "`+strings.Repeat(`1 egg\n`, 500)+`"}`, apiParseHandler)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// failingRenderer can't render anything
+type failingRenderer struct{}
+
+func (failingRenderer) Ext() string {
+	return "fail"
+}
+
+func (failingRenderer) Render(ctx context.Context, g recipe.Graph, w io.Writer) error {
+	return errors.New("out of ink")
+}
+
+func TestGraphError(t *testing.T) {
+	renderer := recipe.GraphRenderer
+	recipe.GraphRenderer = failingRenderer{}
+	defer func() { recipe.GraphRenderer = renderer }()
+
+	w := serve("POST", "/api/plan", "/api/plan", `{"recipe": "pancakes"}`, apiPlanHandler)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "graph_error", errorBody(t, w))
+	reply, ok := wsreply(context.Background(), []byte(`{"type": "plan", "id": "g1", "payload": {"recipe": "pancakes"}}`), 1)
+	assert.True(t, ok)
+	assert.Equal(t, "graph_error", reply.Error.Code)
+}
+
+func TestRequestFlags(t *testing.T) {
+	fs := flag.NewFlagSet("plan", flag.ContinueOnError)
+	request := requestFlags(fs)
+	assert.Nil(t, fs.Parse(nil))
+	assert.Equal(t, map[string]struct{}{"pancakes": {}}, request("pancakes").IngredientsToBuild)
+
+	fs = flag.NewFlagSet("plan", flag.ContinueOnError)
+	request = requestFlags(fs)
+	assert.Nil(t, fs.Parse([]string{"--make", "butter", "--minutes", "30"}))
+	assert.Equal(t, map[string]struct{}{"pancakes": {}, "butter": {}}, request("pancakes").IngredientsToBuild)
+
+	// the recipe is made, not bought
+	plan, err := recipe.GetPlan(request("pancakes"))
+	assert.Nil(t, err)
+	for _, ing := range plan.Ingredients {
+		assert.NotEqual(t, "pancakes", ing.Name)
+	}
+}
+
+func TestExportCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	// a reaction without products is skipped
+	catalog := path.Join(dir, "recipes.toml")
+	assert.Nil(t, ioutil.WriteFile(catalog, []byte("[[reaction]]\ntitle = \"Nothing\"\n\n[[reaction]]\n[[reaction.product]]\nname=\"toast\"\namount = 1.0\nmeasure = \"whole\"\n[[reaction.reactant]]\nname=\"bread\"\namount = 1.0\nmeasure = \"whole\"\n"), 0644))
+	recipe.CatalogFile = catalog
+	defer func() { recipe.CatalogFile = "recipes.toml" }()
+
+	assert.Nil(t, exportCommand([]string{"--dir", path.Join(dir, "cook")}))
+	files, err := ioutil.ReadDir(path.Join(dir, "cook"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, "toast.cook", files[0].Name())
+}
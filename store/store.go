@@ -0,0 +1,84 @@
+// Package store keeps values in a local directory, one file per value,
+// under short ids that are derived from the values themselves, so the same
+// value always gets the same id.
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// idLength is the length of the shortest ids
+const idLength = 8
+
+// ErrNotFound is returned for ids that aren't in the store
+var ErrNotFound = errors.New("not found")
+
+var encoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// Store is a directory of values
+type Store struct {
+	dir   string
+	mutex sync.Mutex
+}
+
+// Open opens the store in the directory, creating it if needed
+func Open(dir string) (s *Store, err error) {
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return
+	}
+	s = &Store{dir: dir}
+	return
+}
+
+func (s *Store) fileName(id string) string {
+	return path.Join(s.dir, id+".json")
+}
+
+// Put saves the value and returns its id. The id is the shortest prefix of
+// the hash of the value that isn't already used by a different value.
+func (s *Store) Put(value []byte) (id string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sum := sha256.Sum256(value)
+	hash := encoding.EncodeToString(sum[:])
+	for length := idLength; length <= len(hash); length++ {
+		id = hash[:length]
+		existing, errRead := ioutil.ReadFile(s.fileName(id))
+		if os.IsNotExist(errRead) {
+			err = ioutil.WriteFile(s.fileName(id), value, 0644)
+			return
+		} else if errRead != nil {
+			err = errRead
+			return
+		}
+		if bytes.Equal(existing, value) {
+			return
+		}
+	}
+	err = errors.New("no id left for value")
+	return
+}
+
+// Get returns the value of the id
+func (s *Store) Get(id string) (value []byte, err error) {
+	if len(id) < idLength || strings.Trim(id, "abcdefghijklmnopqrstuvwxyz234567") != "" {
+		err = ErrNotFound
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	value, err = ioutil.ReadFile(s.fileName(id))
+	if os.IsNotExist(err) {
+		err = ErrNotFound
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := Open(dir)
+	assert.Nil(t, err)
+
+	id, err := s.Put([]byte(`{"recipe":"pancakes"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, idLength, len(id))
+	id2, err := s.Put([]byte(`{"recipe":"pancakes"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, id, id2)
+	value, err := s.Get(id)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"recipe":"pancakes"}`, string(value))
+
+	// a different value with the same short id gets a longer id
+	assert.Nil(t, ioutil.WriteFile(s.fileName(id), []byte("something else"), 0644))
+	id3, err := s.Put([]byte(`{"recipe":"pancakes"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, idLength+1, len(id3))
+	assert.Equal(t, id, id3[:idLength])
+
+	_, err = s.Get("../../etc/passwd")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Get("aaaaaaaa")
+	assert.Equal(t, ErrNotFound, err)
+}